@@ -0,0 +1,347 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+)
+
+// Subcommands
+const (
+	CommandRun      = "run"
+	CommandServe    = "serve"
+	CommandAgent    = "agent"
+	CommandValidate = "validate"
+	CommandWait     = "wait"
+)
+
+// command describes a subcommand, its flags and help text
+type command struct {
+	name    string
+	summary string
+	example string
+	flags   func(fs *flag.FlagSet)
+}
+
+// commands lists the subcommands in the order they are shown in help
+var commands = []command{
+	{
+		name:    CommandRun,
+		summary: "Execute inputs once, print the results and exit non-zero on failed checks",
+		example: `mcall run -c etc/allow_access.yaml
+  mcall run -i "http://localhost:3000/healthcheck::OK"`,
+		flags: func(fs *flag.FlagSet) {
+			configFlags(fs)
+			inputFlags(fs)
+			selectFlags(fs)
+			checkFlags(fs)
+			outputFlags(fs)
+		},
+	},
+	{
+		name:    CommandServe,
+		summary: "Run the web server that executes inputs on request",
+		example: "mcall serve -p 8080",
+		flags: func(fs *flag.FlagSet) {
+			configFlags(fs)
+			fs.String("host", "", "Webserver host (env MCALL_HTTP_HOST, default: webserver.host or "+DefaultHTTPHost+")")
+			fs.String("p", "", "Webserver port (env MCALL_HTTP_PORT, default: webserver.port or "+DefaultHTTPPort+")")
+			checkFlags(fs)
+			outputFlags(fs)
+		},
+	},
+	{
+		name:    CommandAgent,
+		summary: "Run as a Kubernetes leader-election worker executing the configured inputs",
+		example: "mcall agent -c /etc/mcall/mcall.yaml -namespace monitoring",
+		flags: func(fs *flag.FlagSet) {
+			configFlags(fs)
+			fs.String("namespace", "", "Namespace for leader election and tasks (env NAMESPACE, default: default)")
+			selectFlags(fs)
+			checkFlags(fs)
+		},
+	},
+	{
+		name:    CommandValidate,
+		summary: "Check a configuration and its inputs without executing anything",
+		example: "mcall validate -c etc/allow_access.yaml",
+		flags: func(fs *flag.FlagSet) {
+			configFlags(fs)
+			inputFlags(fs)
+			selectFlags(fs)
+		},
+	},
+	{
+		name:    CommandWait,
+		summary: "Poll inputs until they pass or the deadline expires",
+		example: `mcall wait -deadline 2m -i "http://localhost:3000/healthcheck::OK"`,
+		flags: func(fs *flag.FlagSet) {
+			configFlags(fs)
+			inputFlags(fs)
+			selectFlags(fs)
+			checkFlags(fs)
+			outputFlags(fs)
+			fs.String("deadline", "", "How long to poll before giving up (default: "+DefaultWaitDeadline.String()+")")
+			fs.String("interval", "", "Delay between polls (default: "+DefaultWaitInterval.String()+")")
+		},
+	},
+}
+
+// legacyCommand accepts the flag-only command line used before subcommands:
+// -w serves, LEADER_ELECTION=true runs the agent, anything else runs inputs
+var legacyCommand = command{
+	name: "",
+	flags: func(fs *flag.FlagSet) {
+		configFlags(fs)
+		inputFlags(fs)
+		selectFlags(fs)
+		checkFlags(fs)
+		outputFlags(fs)
+		fs.Bool("w", false, "Run webserver")
+		fs.String("p", "", "Webserver port")
+	},
+}
+
+// configFlags registers the flags shared by every subcommand
+func configFlags(fs *flag.FlagSet) {
+	fs.Var(&stringList{}, "c", "Configuration file path, repeatable; later files override earlier ones (env MCALL_CONFIG, comma separated)")
+	fs.String("profile", "", "Configuration profile to overlay (env MCALL_PROFILE)")
+	fs.Var(&stringList{}, "set", "Template variable key=value for inputs, repeatable")
+	fs.String("l", "", "Log level: debug, info, error (env MCALL_LOG_LEVEL, default: log.level or debug)")
+	fs.String("lf", "", "Log file (env MCALL_LOG_FILE, default: log.file or "+DefaultLogFile+")")
+}
+
+// inputFlags registers the ad-hoc input flags
+func inputFlags(fs *flag.FlagSet) {
+	fs.String("i", "", "Input (command or URL, multiple separated by comma), @file or - to read inputs per line")
+	fs.String("t", "", "Default request type (cmd, sh, tcp, get, post, put, patch, delete, head, options, http)")
+	fs.String("n", "", "Default request name")
+	fs.Var(&stringList{}, "input", "Input, repeatable; \"input::expect\" sets its expect")
+	fs.Var(&stringList{}, "expect", "Expect for the input at the same position, repeatable")
+	fs.Var(&stringList{}, "name", "Name for the input at the same position, repeatable")
+	fs.Var(&stringList{}, "type", "Type for the input at the same position, repeatable")
+}
+
+// selectFlags registers the flags selecting which inputs run
+func selectFlags(fs *flag.FlagSet) {
+	fs.String("tags", "", "Run only inputs with any of these tags, labels (team=payments) or types (type=tcp), comma separated")
+	fs.String("exclude-tags", "", "Skip inputs with any of these tags, labels or types, comma separated")
+	fs.String("name-regex", "", "Run only inputs whose name matches this regular expression")
+}
+
+// checkFlags registers the flags controlling how inputs are executed
+func checkFlags(fs *flag.FlagSet) {
+	fs.Int("worker", 0, "Number of workers (env MCALL_WORKER_NUM, default: worker.number or 10)")
+	fs.Int("timeout", 0, "Timeout in seconds for each input (env MCALL_TIMEOUT, default: request.timeout or 10)")
+	fs.Int("retries", 0, "Retries for each failed input (env MCALL_RETRIES, default: request.retries or 0)")
+}
+
+// outputFlags registers the flags controlling results and exit status
+func outputFlags(fs *flag.FlagSet) {
+	fs.String("f", "", "Return format: json, plain (env MCALL_FORMAT, default: response.format or json)")
+	fs.String("e", "", "Return result with encoding (std, url)")
+	fs.String("order", "", "Result order: input, completion (default: response.order or input)")
+	fs.String("fail-on", "", "Exit non-zero when checks fail: any, all, threshold (env MCALL_FAIL_ON, default: exit.failOn or any)")
+	fs.String("threshold", "", "Failed checks for -fail-on=threshold, as a count or percentage like 25% (env MCALL_THRESHOLD)")
+}
+
+// stringList is a flag that may be repeated
+type stringList []string
+
+func (l *stringList) String() string {
+	if l == nil {
+		return ""
+	}
+	return strings.Join(*l, ",")
+}
+
+func (l *stringList) Set(value string) error {
+	*l = append(*l, value)
+	return nil
+}
+
+func (l *stringList) Get() interface{} {
+	return []string(*l)
+}
+
+// lookupCommand finds a subcommand by name
+func lookupCommand(name string) (command, bool) {
+	for _, cmd := range commands {
+		if cmd.name == name {
+			return cmd, true
+		}
+	}
+	return command{}, false
+}
+
+// parseCommandLine selects the subcommand and parses its flags. Only flags
+// given on the command line end up in Args, so unset flags never override
+// the environment or the config file.
+func parseCommandLine(argv []string, output io.Writer) (Args, error) {
+	cmd := legacyCommand
+	if len(argv) > 0 && !strings.HasPrefix(argv[0], "-") {
+		found, ok := lookupCommand(argv[0])
+		if !ok {
+			return nil, fmt.Errorf("unknown command %q", argv[0])
+		}
+		cmd, argv = found, argv[1:]
+	}
+
+	fs := flag.NewFlagSet("mcall "+cmd.name, flag.ContinueOnError)
+	fs.SetOutput(output)
+	cmd.flags(fs)
+	fs.Usage = func() {
+		if cmd.name == "" {
+			printUsage(output)
+			return
+		}
+		fmt.Fprintf(output, "Usage: mcall %s [flags]\n\n%s\n\nExample:\n  %s\n\nFlags:\n", cmd.name, cmd.summary, cmd.example)
+		fs.PrintDefaults()
+	}
+
+	if err := fs.Parse(argv); err != nil {
+		return nil, err
+	}
+	if fs.NArg() > 0 {
+		return nil, fmt.Errorf("unexpected arguments: %s", strings.Join(fs.Args(), " "))
+	}
+
+	args := Args{"command": cmd.name}
+	fs.Visit(func(f *flag.Flag) {
+		args[f.Name] = f.Value.(flag.Getter).Get()
+	})
+	return args, nil
+}
+
+// printUsage lists the subcommands
+func printUsage(w io.Writer) {
+	fmt.Fprintln(w, "Usage: mcall <command> [flags]")
+	fmt.Fprintln(w, "")
+	fmt.Fprintln(w, "Commands:")
+	for _, cmd := range commands {
+		fmt.Fprintf(w, "  %-9s %s\n", cmd.name, cmd.summary)
+	}
+	fmt.Fprintln(w, "")
+	fmt.Fprintln(w, "Run \"mcall <command> -h\" for the flags of a command.")
+	fmt.Fprintln(w, "Settings are taken from flags first, then MCALL_* environment variables, then the config file.")
+	fmt.Fprintln(w, "")
+	fmt.Fprintln(w, "Examples:")
+	fmt.Fprintln(w, "  mcall run -i=\"ls /etc/hosts\"")
+	fmt.Fprintf(w, "  mcall run -t=%s -i=\"http://localhost:%s/healthcheck\"\n", RequestTypeGet, DefaultHTTPPort)
+	fmt.Fprintln(w, "  mcall run -c=/etc/mcall/mcall.yaml")
+	fmt.Fprintln(w, "  mcall serve -p=8080")
+	fmt.Fprintf(w, "  mcall wait -deadline=2m -i=\"http://localhost:%s/healthcheck\"\n", DefaultHTTPPort)
+}
+
+// runCLI runs the command line and returns the process exit code
+func runCLI(argv []string, stdout, stderr io.Writer) int {
+	if len(argv) == 0 || argv[0] == "help" {
+		printUsage(stdout)
+		return ExitOK
+	}
+
+	args, err := parseCommandLine(argv, stderr)
+	if errors.Is(err, flag.ErrHelp) {
+		return ExitOK
+	}
+	if err != nil {
+		fmt.Fprintf(stderr, "Error: %v\n", err)
+		return ExitConfigError
+	}
+
+	if err := mainExec(args); err != nil {
+		// The summary line already describes failed checks
+		var failure *CheckFailure
+		if errors.As(err, &failure) {
+			return ExitCheckFailed
+		}
+		fmt.Fprintf(stderr, "Error: %v\n", err)
+		return ExitConfigError
+	}
+	return ExitOK
+}
+
+// applyArgs overrides config settings with the flags given on the command line
+func applyArgs(config *Config, args Args) {
+	if args.Bool("w") {
+		config.WebServer.Enable = true
+	}
+	if v := args.String("host"); v != "" {
+		config.WebServer.Host = v
+	}
+	if v := args.String("p"); v != "" {
+		config.WebServer.Port = v
+	}
+	if v := args.String("l"); v != "" {
+		config.Log.Level = v
+	}
+	if v := args.String("lf"); v != "" {
+		config.Log.File = v
+	}
+	if v := args.Int("worker"); v > 0 {
+		config.Worker.Number = v
+	}
+	if v := args.Int("timeout"); v > 0 {
+		config.Request.Timeout = v
+	}
+	if args.Has("retries") {
+		config.Request.Retries = args.Int("retries")
+	}
+	if v := args.String("f"); v != "" {
+		config.Response.Format = v
+	}
+	if v := args.String("e"); v != "" {
+		config.Response.Encoding.Type = v
+	}
+	if v := args.String("order"); v != "" {
+		config.Response.Order = v
+	}
+	if v := args.String("fail-on"); v != "" {
+		config.Exit.FailOn = v
+	}
+	if v := args.String("threshold"); v != "" {
+		config.Exit.Threshold = v
+	}
+}
+
+// configFiles resolves the config files from -c, then MCALL_CONFIG
+func configFiles(args Args) []string {
+	if files := args.Strings("c"); len(files) > 0 {
+		return files
+	}
+	var files []string
+	for _, file := range strings.Split(os.Getenv("MCALL_CONFIG"), ",") {
+		if file = strings.TrimSpace(file); file != "" {
+			files = append(files, file)
+		}
+	}
+	return files
+}
+
+// configProfile resolves the config profile from --profile, then MCALL_PROFILE
+func configProfile(args Args) string {
+	if profile := args.String("profile"); profile != "" {
+		return profile
+	}
+	return os.Getenv("MCALL_PROFILE")
+}
+
+// templateVars reads the --set key=value template variables
+func templateVars(args Args) (map[string]string, error) {
+	sets := args.Strings("set")
+	if len(sets) == 0 {
+		return nil, nil
+	}
+	vars := make(map[string]string, len(sets))
+	for _, set := range sets {
+		key, value, ok := strings.Cut(set, "=")
+		if key = strings.TrimSpace(key); !ok || key == "" {
+			return nil, fmt.Errorf("invalid --set %q: want key=value", set)
+		}
+		vars[key] = value
+	}
+	return vars, nil
+}
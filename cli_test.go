@@ -0,0 +1,127 @@
+package main
+
+import (
+	"flag"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// TestParseCommandLine tests subcommand selection and that only given flags reach Args
+func TestParseCommandLine(t *testing.T) {
+	args, err := parseCommandLine([]string{"run", "-c", "etc/mcall.yaml", "--input", "pwd", "--input", "echo hi::hi", "-worker=3"}, io.Discard)
+	assert.NoError(t, err)
+	assert.Equal(t, Args{
+		"command": CommandRun,
+		"c":       []string{"etc/mcall.yaml"},
+		"input":   []string{"pwd", "echo hi::hi"},
+		"worker":  3,
+	}, args)
+
+	args, err = parseCommandLine([]string{"wait", "-deadline=30s", "-i", "true"}, io.Discard)
+	assert.NoError(t, err)
+	assert.Equal(t, CommandWait, args.String("command"))
+	assert.Equal(t, "30s", args.String("deadline"))
+	assert.False(t, args.Has("interval"))
+
+	// Flag-only command lines keep working
+	args, err = parseCommandLine([]string{"-w=true", "-p", "8080"}, io.Discard)
+	assert.NoError(t, err)
+	assert.Equal(t, "", args.String("command"))
+	assert.True(t, args.Bool("w"))
+	assert.Equal(t, "8080", args.String("p"))
+
+	_, err = parseCommandLine([]string{"deploy"}, io.Discard)
+	assert.EqualError(t, err, `unknown command "deploy"`)
+	_, err = parseCommandLine([]string{"serve", "-i", "pwd"}, io.Discard)
+	assert.Error(t, err, "serve has no input flags")
+	_, err = parseCommandLine([]string{"run", "pwd"}, io.Discard)
+	assert.EqualError(t, err, "unexpected arguments: pwd")
+	_, err = parseCommandLine([]string{"validate", "-h"}, io.Discard)
+	assert.ErrorIs(t, err, flag.ErrHelp)
+}
+
+// TestArgsAccessors tests that missing or mistyped arguments read as zero values
+func TestArgsAccessors(t *testing.T) {
+	args := Args{"i": "pwd", "worker": 2, "w": true, "input": []string{"a"}}
+	assert.Equal(t, "pwd", args.String("i"))
+	assert.Equal(t, 2, args.Int("worker"))
+	assert.True(t, args.Bool("w"))
+	assert.Equal(t, []string{"a"}, args.Strings("input"))
+
+	assert.Equal(t, "", args.String("missing"))
+	assert.Equal(t, 0, args.Int("i"))
+	assert.False(t, args.Bool("missing"))
+	assert.Nil(t, args.Strings("missing"))
+	assert.False(t, args.Has("missing"))
+}
+
+// TestSettingPrecedence tests that flags override the environment, which overrides the config file
+func TestSettingPrecedence(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "mcall.yaml")
+	assert.NoError(t, os.WriteFile(path, []byte(`worker:
+    number: 5
+request:
+    timeout: 10
+    retries: 3
+log:
+    level: DEBUG
+exit:
+    failOn: any
+`), 0644))
+
+	t.Setenv("MCALL_WORKER_NUM", "8")
+	t.Setenv("MCALL_TIMEOUT", "20")
+	t.Setenv("MCALL_FAIL_ON", FailOnAll)
+	t.Setenv("MCALL_EXIT_FAILON", FailOnThreshold)
+	config, err := loadConfig(path)
+	assert.NoError(t, err)
+	applyArgs(config, Args{"worker": 12, "l": "ERROR"})
+
+	assert.Equal(t, 12, config.Worker.Number, "flag wins over env")
+	assert.Equal(t, 20, config.Request.Timeout, "env alias wins over config")
+	assert.Equal(t, FailOnThreshold, config.Exit.FailOn, "MCALL_<SECTION>_<KEY> wins over its alias")
+	assert.Equal(t, "ERROR", config.Log.Level, "flag wins over config")
+
+	// An explicit -retries=0 turns off retries from the config file
+	applyArgs(config, Args{"retries": 0})
+	assert.Equal(t, 0, config.Request.Retries)
+
+	t.Setenv("MCALL_RETRIES", "many")
+	_, err = loadConfig(path)
+	assert.ErrorContains(t, err, "request.retries")
+}
+
+// TestRunCLI tests the exit codes for help, usage errors and checks
+func TestRunCLI(t *testing.T) {
+	var stdout, stderr strings.Builder
+	assert.Equal(t, ExitOK, runCLI(nil, &stdout, &stderr))
+	assert.Contains(t, stdout.String(), "Commands:")
+	assert.Contains(t, stdout.String(), CommandValidate)
+
+	stderr.Reset()
+	assert.Equal(t, ExitConfigError, runCLI([]string{"deploy"}, &stdout, &stderr))
+	assert.Contains(t, stderr.String(), `unknown command "deploy"`)
+
+	stderr.Reset()
+	assert.Equal(t, ExitOK, runCLI([]string{"run", "-h"}, &stdout, &stderr))
+	assert.Contains(t, stderr.String(), "Usage: mcall run [flags]")
+
+	logFile := t.TempDir() + "/mcall.log"
+	assert.Equal(t, ExitOK, runCLI([]string{"run", "-lf", logFile, "-i", "echo hi::hi"}, &stdout, &stderr))
+	assert.Equal(t, ExitCheckFailed, runCLI([]string{"run", "-lf", logFile, "-i", "echo hi::bye"}, &stdout, &stderr))
+	assert.Equal(t, ExitConfigError, runCLI([]string{"run", "-lf", logFile}, &stdout, &stderr))
+	assert.Equal(t, ExitOK, runCLI([]string{"validate", "-lf", logFile, "-i", "echo hi::status == 200"}, &stdout, &stderr))
+	assert.Equal(t, ExitConfigError, runCLI([]string{"validate", "-lf", logFile, "-i", "echo hi::status == "}, &stdout, &stderr))
+
+	// A config with problems fails before any check runs
+	badConfig := t.TempDir() + "/bad.yaml"
+	assert.NoError(t, os.WriteFile(badConfig, []byte("request:\n  typ: get\n"), 0644))
+	stderr.Reset()
+	assert.Equal(t, ExitConfigError, runCLI([]string{"run", "-lf", logFile, "-c", badConfig, "-i", "true"}, &stdout, &stderr))
+	assert.Contains(t, stderr.String(), badConfig+":2: request.typ: unknown key")
+}
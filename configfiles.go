@@ -0,0 +1,248 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// configSource is one config file read for a run, in merge order
+type configSource struct {
+	Path     string
+	Data     []byte
+	Root     *yaml.Node   // interpolated top-level mapping, nil when empty or invalid
+	Problems []Diagnostic // YAML and interpolation problems in Data
+	Includes []string     // include patterns, relative to the working directory
+}
+
+// resolveConfigFiles reads the config files in order, each followed by the
+// files its include patterns match. Patterns are relative to the including
+// file and their matches are read in sorted order; a file included twice is
+// read once. Of the profiles, only the named one is interpolated. It returns
+// the files that could be read and the read and include problems found.
+func resolveConfigFiles(paths []string, profile string) ([]configSource, []Diagnostic) {
+	var sources []configSource
+	var diagnostics []Diagnostic
+	seen := map[string]bool{}
+
+	var visit func(path string)
+	visit = func(path string) {
+		if abs, err := filepath.Abs(path); err == nil {
+			if seen[abs] {
+				return
+			}
+			seen[abs] = true
+		}
+
+		data, err := os.ReadFile(path)
+		if err != nil {
+			diagnostics = append(diagnostics, Diagnostic{File: path, Message: err.Error()})
+			return
+		}
+		source := parseConfigSource(path, data, profile)
+		index := len(sources)
+		sources = append(sources, source)
+
+		include := configNode(source.Root, "include")
+		if include == nil {
+			return
+		}
+		for _, node := range includePatterns(include) {
+			pattern := node.Value
+			if !filepath.IsAbs(pattern) {
+				pattern = filepath.Join(filepath.Dir(path), pattern)
+			}
+			sources[index].Includes = append(sources[index].Includes, pattern)
+			matches, err := filepath.Glob(pattern)
+			if err != nil {
+				diagnostics = append(diagnostics, Diagnostic{File: path, Line: node.Line, Message: fmt.Sprintf("include %s: %v", pattern, err)})
+				continue
+			}
+			// A pattern without wildcards names a file that must exist
+			if len(matches) == 0 && !strings.ContainsAny(pattern, "*?[") {
+				diagnostics = append(diagnostics, Diagnostic{File: path, Line: node.Line, Message: fmt.Sprintf("include %s: no such file", pattern)})
+			}
+			for _, match := range matches {
+				visit(match)
+			}
+		}
+	}
+
+	for _, path := range paths {
+		visit(path)
+	}
+	return sources, diagnostics
+}
+
+// parseConfigSource parses and interpolates one config file, leaving the
+// profiles other than profile as written
+func parseConfigSource(path string, data []byte, profile string) configSource {
+	source := configSource{Path: path, Data: data}
+	report := func(line int, format string, args ...interface{}) {
+		source.Problems = append(source.Problems, Diagnostic{File: path, Line: line, Message: fmt.Sprintf(format, args...)})
+	}
+
+	var doc yaml.Node
+	if err := yaml.Unmarshal(data, &doc); err != nil {
+		line, message := yamlErrorLine(err)
+		report(line, "%s", message)
+		return source
+	}
+	if len(doc.Content) == 0 {
+		return source
+	}
+	expandConfigNode(selectProfile(doc.Content[0], profile), "", expandEnv, report)
+	if root := doc.Content[0]; root.Kind == yaml.MappingNode {
+		source.Root = root
+	}
+	return source
+}
+
+// includePatterns reads include as a single pattern or a list of them
+func includePatterns(include *yaml.Node) []*yaml.Node {
+	if include.Kind == yaml.ScalarNode {
+		return []*yaml.Node{include}
+	}
+	var patterns []*yaml.Node
+	for _, item := range include.Content {
+		if item.Kind == yaml.ScalarNode && item.Value != "" {
+			patterns = append(patterns, item)
+		}
+	}
+	return patterns
+}
+
+// readConfigFiles reads config files and the files they include, merges them
+// in order and overlays the named profile
+func readConfigFiles(paths []string, profile string) ([]byte, error) {
+	sources, diagnostics := resolveConfigFiles(paths, profile)
+	for _, source := range sources {
+		diagnostics = append(diagnostics, source.Problems...)
+	}
+	if len(diagnostics) > 0 {
+		return nil, &ValidationError{Diagnostics: diagnostics}
+	}
+
+	merged := &yaml.Node{Kind: yaml.MappingNode, Tag: "!!map"}
+	for _, source := range sources {
+		if source.Root != nil {
+			mergeConfigNode(merged, source.Root, "")
+		}
+	}
+
+	profiles := removeConfigKey(merged, "profiles")
+	removeConfigKey(merged, "include")
+	if profile != "" {
+		overlay := configNode(profiles, profile)
+		if overlay == nil {
+			return nil, fmt.Errorf("unknown profile %q%s", profile, profileList(profiles))
+		}
+		mergeConfigNode(merged, overlay, "")
+	}
+	return yaml.Marshal(merged)
+}
+
+// mergeConfigNode merges the src mapping into dst. Maps are merged key by
+// key, request.inputs lists are appended so every file can add checks, and
+// any other value in src replaces the one in dst.
+func mergeConfigNode(dst, src *yaml.Node, path string) {
+	for i := 0; i+1 < len(src.Content); i += 2 {
+		key, value := src.Content[i], src.Content[i+1]
+		name := key.Value
+		if path != "" {
+			name = path + "." + key.Value
+		}
+
+		j := mappingIndex(dst, key.Value)
+		if j < 0 {
+			dst.Content = append(dst.Content, key, value)
+			continue
+		}
+		current := dst.Content[j+1]
+		switch {
+		case current.Kind == yaml.MappingNode && value.Kind == yaml.MappingNode:
+			mergeConfigNode(current, value, name)
+		case current.Kind == yaml.SequenceNode && value.Kind == yaml.SequenceNode && isInputsKey(name):
+			current.Content = append(current.Content, value.Content...)
+		default:
+			dst.Content[j+1] = value
+		}
+	}
+}
+
+// isInputsKey reports whether a key path is a request.inputs list, at the
+// top level or in a profile
+func isInputsKey(path string) bool {
+	path = strings.ToLower(path)
+	return path == "request.inputs" || strings.HasSuffix(path, ".request.inputs")
+}
+
+// mappingIndex returns the index of key in a mapping node, ignoring case the
+// way viper does, or -1
+func mappingIndex(node *yaml.Node, key string) int {
+	for i := 0; i+1 < len(node.Content); i += 2 {
+		if strings.EqualFold(node.Content[i].Value, key) {
+			return i
+		}
+	}
+	return -1
+}
+
+// removeConfigKey removes key from a mapping node and returns its value
+func removeConfigKey(node *yaml.Node, key string) *yaml.Node {
+	i := mappingIndex(node, key)
+	if i < 0 {
+		return nil
+	}
+	value := node.Content[i+1]
+	node.Content = append(node.Content[:i], node.Content[i+2:]...)
+	return value
+}
+
+// selectProfile returns a config mapping whose profiles map holds only the
+// named profile, sharing its nodes with root. Interpolating and checking the
+// result leaves out the profiles not selected, so they may use variables that
+// are only set where they are selected.
+func selectProfile(root *yaml.Node, profile string) *yaml.Node {
+	i := mappingIndex(root, "profiles")
+	if root.Kind != yaml.MappingNode || i < 0 || root.Content[i+1].Kind != yaml.MappingNode {
+		return root
+	}
+	profiles := *root.Content[i+1]
+	profiles.Content = nil
+	for j := 0; j+1 < len(root.Content[i+1].Content); j += 2 {
+		if name := root.Content[i+1].Content[j]; profile != "" && strings.EqualFold(name.Value, profile) {
+			profiles.Content = append(profiles.Content, name, root.Content[i+1].Content[j+1])
+		}
+	}
+
+	view := *root
+	view.Content = append([]*yaml.Node(nil), root.Content...)
+	view.Content[i+1] = &profiles
+	return &view
+}
+
+// profileNames lists the profiles defined in a profiles mapping
+func profileNames(profiles *yaml.Node) []string {
+	var names []string
+	if profiles != nil && profiles.Kind == yaml.MappingNode {
+		for i := 0; i+1 < len(profiles.Content); i += 2 {
+			names = append(names, profiles.Content[i].Value)
+		}
+	}
+	sort.Strings(names)
+	return names
+}
+
+// profileList describes the defined profiles for an unknown profile error
+func profileList(profiles *yaml.Node) string {
+	names := profileNames(profiles)
+	if len(names) == 0 {
+		return " (no profiles defined)"
+	}
+	return fmt.Sprintf(" (have %s)", strings.Join(names, ", "))
+}
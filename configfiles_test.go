@@ -0,0 +1,158 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// writeConfigFiles writes files relative to a temporary directory and returns it
+func writeConfigFiles(t *testing.T, files map[string]string) string {
+	dir := t.TempDir()
+	for name, content := range files {
+		path := filepath.Join(dir, name)
+		assert.NoError(t, os.MkdirAll(filepath.Dir(path), 0755))
+		assert.NoError(t, os.WriteFile(path, []byte(content), 0644))
+	}
+	return dir
+}
+
+// TestLoadConfigFiles tests includes, merge order across files and profiles
+func TestLoadConfigFiles(t *testing.T) {
+	dir := writeConfigFiles(t, map[string]string{
+		"mcall.yaml": `include: [checks.d/*.yaml]
+request:
+    timeout: 5
+    inputs:
+        - input: echo base
+worker:
+    number: 2
+profiles:
+    prod:
+        worker:
+            number: 20
+        request:
+            inputs:
+                - input: echo prod
+`,
+		"checks.d/b-payments.yaml": "request:\n    inputs:\n        - input: echo payments\n",
+		"checks.d/a-search.yaml":   "include: ../mcall.yaml\nrequest:\n    inputs:\n        - input: echo search\n",
+		"override.yaml":            "request:\n    timeout: 9\nworker:\n    number: 4\n",
+	})
+	base := filepath.Join(dir, "mcall.yaml")
+	override := filepath.Join(dir, "override.yaml")
+
+	inputs := func(config *Config) []string {
+		var names []string
+		for _, input := range config.Request.Inputs {
+			names = append(names, input.Input)
+		}
+		return names
+	}
+
+	t.Setenv("MCALL_WORKER_NUM", "") // set for every test by setupTestEnvironment
+
+	config, err := loadConfigFiles([]string{base}, "")
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"echo base", "echo search", "echo payments"}, inputs(config), "includes follow their file in sorted order, each read once")
+	assert.Equal(t, 5, config.Request.Timeout)
+	assert.Equal(t, 2, config.Worker.Number)
+
+	config, err = loadConfigFiles([]string{base, override}, "")
+	assert.NoError(t, err)
+	assert.Equal(t, 9, config.Request.Timeout, "later files win")
+	assert.Equal(t, 4, config.Worker.Number)
+	assert.Len(t, config.Request.Inputs, 3)
+
+	config, err = loadConfigFiles([]string{base, override}, "prod")
+	assert.NoError(t, err)
+	assert.Equal(t, 20, config.Worker.Number, "the profile overlays every file")
+	assert.Equal(t, 9, config.Request.Timeout)
+	assert.Equal(t, []string{"echo base", "echo search", "echo payments", "echo prod"}, inputs(config))
+
+	_, err = loadConfigFiles([]string{base}, "staging")
+	assert.EqualError(t, err, `failed to read config file: unknown profile "staging" (have prod)`)
+}
+
+// TestValidateConfigFilesIncludes tests that included files and the selected
+// profile are checked, and that other profiles are neither interpolated nor
+// checked
+func TestValidateConfigFilesIncludes(t *testing.T) {
+	dir := writeConfigFiles(t, map[string]string{
+		"mcall.yaml": `include:
+    - checks.d/*.yaml
+    - missing.yaml
+profiles:
+    prod:
+        worker:
+            count: 3
+        request:
+            inputs:
+                - input: http://api/health
+                  type: gte
+    staging:
+        request:
+            inputs:
+                - input: ${STAGING_URL}/health
+                  type: get
+`,
+		"checks.d/redis.yaml": "request:\n    inputs:\n        - input: redis:port\n          type: tcp\n",
+	})
+	base := filepath.Join(dir, "mcall.yaml")
+
+	validate := func(profile string) []string {
+		var lines []string
+		for _, d := range validateConfigFiles([]string{base}, profile, nil) {
+			lines = append(lines, d.String())
+		}
+		return lines
+	}
+	assert.Equal(t, []string{
+		base + `:3: include ` + filepath.Join(dir, "missing.yaml") + `: no such file`,
+		base + `:7: profiles.prod.worker.count: unknown key`,
+		base + `:10: profiles.prod.request.inputs #1 (http://api/health): unknown type "gte" (want cmd, sh, tcp, http or an HTTP method like get)`,
+		filepath.Join(dir, "checks.d/redis.yaml") + `:3: request.inputs #1 (redis:port): invalid tcp address "redis:port": bad port "port"`,
+	}, validate("prod"))
+	assert.Equal(t, []string{
+		base + `:3: include ` + filepath.Join(dir, "missing.yaml") + `: no such file`,
+		base + `:15: profiles.staging.request.inputs[0].input: environment variable STAGING_URL is not set`,
+		base + `:15: profiles.staging.request.inputs #1 (${STAGING_URL}/health): invalid URL "${STAGING_URL}/health": scheme must be http or https`,
+		filepath.Join(dir, "checks.d/redis.yaml") + `:3: request.inputs #1 (redis:port): invalid tcp address "redis:port": bad port "port"`,
+	}, validate("staging"))
+	assert.Equal(t, []string{
+		base + `:3: include ` + filepath.Join(dir, "missing.yaml") + `: no such file`,
+		filepath.Join(dir, "checks.d/redis.yaml") + `:3: request.inputs #1 (redis:port): invalid tcp address "redis:port": bad port "port"`,
+		`unknown profile "dev"`,
+	}, validate("dev"))
+}
+
+// TestLoadConfigFilesProfileInterpolation tests that only the selected
+// profile is interpolated
+func TestLoadConfigFilesProfileInterpolation(t *testing.T) {
+	dir := writeConfigFiles(t, map[string]string{
+		"mcall.yaml": `request:
+    timeout: ${CHECK_TIMEOUT:-5}
+profiles:
+    prod:
+        request:
+            timeout: 30
+    staging:
+        request:
+            inputs:
+                - input: ${STAGING_URL}/health
+`,
+	})
+	base := filepath.Join(dir, "mcall.yaml")
+
+	config, err := loadConfigFiles([]string{base}, "prod")
+	assert.NoError(t, err)
+	assert.Equal(t, 30, config.Request.Timeout)
+	config, err = loadConfigFiles([]string{base}, "")
+	assert.NoError(t, err)
+	assert.Equal(t, 5, config.Request.Timeout)
+
+	_, err = loadConfigFiles([]string{base}, "staging")
+	assert.ErrorContains(t, err, "profiles.staging.request.inputs[0].input: environment variable STAGING_URL is not set")
+}
@@ -0,0 +1,157 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+)
+
+// dependencyGraph links checks to the checks they depend on. Dependencies
+// are named by check name and every check with that name is waited for.
+// Selection keeps the dependencies of the checks it selects, and names no
+// check has are rejected by checkDependencies before a run, so a name
+// missing here is ignored.
+type dependencyGraph struct {
+	deps       [][]int // checks each check waits for
+	dependents [][]int // checks waiting for each check
+}
+
+// newDependencyGraph builds the graph of the dependsOn fields of checks
+func newDependencyGraph(checks []Check) dependencyGraph {
+	byName := make(map[string][]int, len(checks))
+	for i, check := range checks {
+		byName[check.Name] = append(byName[check.Name], i)
+	}
+
+	graph := dependencyGraph{
+		deps:       make([][]int, len(checks)),
+		dependents: make([][]int, len(checks)),
+	}
+	for i, check := range checks {
+		for _, name := range check.DependsOn {
+			for _, j := range byName[name] {
+				if j != i {
+					graph.deps[i] = append(graph.deps[i], j)
+					graph.dependents[j] = append(graph.dependents[j], i)
+				}
+			}
+		}
+	}
+	return graph
+}
+
+// blocked returns the checks that can never start because they are in a
+// dependency cycle or depend on one
+func (g dependencyGraph) blocked() []int {
+	pending := make([]int, len(g.deps))
+	var ready []int
+	for i, deps := range g.deps {
+		pending[i] = len(deps)
+		if pending[i] == 0 {
+			ready = append(ready, i)
+		}
+	}
+	for len(ready) > 0 {
+		i := ready[0]
+		ready = ready[1:]
+		for _, j := range g.dependents[i] {
+			if pending[j]--; pending[j] == 0 {
+				ready = append(ready, j)
+			}
+		}
+	}
+
+	var blocked []int
+	for i, n := range pending {
+		if n > 0 {
+			blocked = append(blocked, i)
+		}
+	}
+	return blocked
+}
+
+// checkDependencies reports dependsOn names that match no check and
+// dependency cycles
+func checkDependencies(checks []Check) []Diagnostic {
+	names := make(map[string]bool, len(checks))
+	for _, check := range checks {
+		names[check.Name] = true
+	}
+
+	var diagnostics []Diagnostic
+	for _, check := range checks {
+		for _, name := range check.DependsOn {
+			if !names[name] {
+				diagnostics = append(diagnostics, Diagnostic{Message: fmt.Sprintf("input %s: dependsOn %q matches no input name", checkLabel(check), name)})
+			}
+		}
+	}
+
+	if blocked := newDependencyGraph(checks).blocked(); len(blocked) > 0 {
+		labels := make([]string, len(blocked))
+		for i, j := range blocked {
+			labels[i] = checkLabel(checks[j])
+		}
+		diagnostics = append(diagnostics, Diagnostic{Message: fmt.Sprintf("dependency cycle: %s can never run", strings.Join(labels, ", "))})
+	}
+	return diagnostics
+}
+
+// checkLabel names a check by its name, falling back to its input
+func checkLabel(check Check) string {
+	if check.Name != "" {
+		return check.Name
+	}
+	return check.Input
+}
+
+// scheduleChecks submits every call once the checks it depends on have
+// finished, in parallel with all other ready calls. A call whose dependency
+// did not pass, or that is caught in a cycle, is not executed and reports a
+// skipped result naming the dependency instead. Each call index received on
+// finished, once its result is in fetched, is passed on to completed.
+func scheduleChecks(calls []*CallFetch, graph dependencyGraph, pipeline *Pipeline, fetched []FetchedResult, finished <-chan int, completed chan<- int) {
+	pending := make([]int, len(calls))
+	released := make([]bool, len(calls))
+	reasons := make([]string, len(calls)) // why a call is skipped
+	release := func(i int) {
+		released[i] = true
+		if reasons[i] != "" {
+			calls[i].result <- calls[i].skippedResult(reasons[i])
+			return
+		}
+		pipeline.request <- calls[i]
+	}
+
+	for _, i := range graph.blocked() {
+		reasons[i] = "dependency cycle"
+		release(i)
+	}
+	for i := range calls {
+		if pending[i] = len(graph.deps[i]); pending[i] == 0 && !released[i] {
+			release(i)
+		}
+	}
+
+	for range calls {
+		i := <-finished
+		completed <- i
+		result := fetched[i]
+		for _, j := range graph.dependents[i] {
+			if reasons[j] == "" && result.Skipped {
+				reasons[j] = fmt.Sprintf("dependency %q was skipped", resultLabel(result))
+			} else if reasons[j] == "" && result.Error != ErrorCodeSuccess {
+				reasons[j] = fmt.Sprintf("dependency %q failed", resultLabel(result))
+			}
+			if pending[j]--; pending[j] == 0 && !released[j] {
+				release(j)
+			}
+		}
+	}
+}
+
+// skippedResult reports a call that was not executed
+func (cf *CallFetch) skippedResult(reason string) FetchedResult {
+	result := cf.newResult(ResultDoc{}, 0, &FetchError{Code: ErrorCodeSkipped, Err: fmt.Errorf("skipped: %s", reason)})
+	result.Skipped = true
+	return result
+}
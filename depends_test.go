@@ -0,0 +1,84 @@
+package main
+
+import (
+	"bytes"
+	"path/filepath"
+	"testing"
+
+	"github.com/op/go-logging"
+	"github.com/stretchr/testify/assert"
+)
+
+// TestRunChecksDependencies tests that dependents wait for their
+// dependencies and are skipped when one did not pass
+func TestRunChecksDependencies(t *testing.T) {
+	app := NewApp(&Config{})
+	app.logger = logging.MustGetLogger("mcall")
+	marker := filepath.Join(t.TempDir(), "migrated")
+
+	checks := []Check{
+		{Name: "verify", Input: "test -f " + marker, Type: RequestTypeShell, InputOptions: InputOptions{DependsOn: []string{"migrate"}}},
+		{Name: "migrate", Input: "sleep 0.2; touch " + marker, Type: RequestTypeShell},
+		{Name: "dns", Input: "exit 1", Type: RequestTypeShell},
+		{Name: "api", Input: "echo api", Type: RequestTypeShell, InputOptions: InputOptions{DependsOn: []string{"dns", "migrate"}}},
+		{Name: "smoke", Input: "echo smoke", Type: RequestTypeShell, InputOptions: InputOptions{DependsOn: []string{"api"}}},
+		{Name: "other", Input: "echo other", Type: RequestTypeShell, InputOptions: InputOptions{DependsOn: []string{"deselected"}}},
+	}
+	results := app.runChecks(checks)
+	assert.Len(t, results, len(checks))
+
+	byName := map[string]FetchedResult{}
+	for _, result := range results {
+		byName[result.Name] = result
+	}
+	assert.Equal(t, ErrorCodeSuccess, byName["verify"].Error, "verify ran after migrate finished")
+	assert.Equal(t, ErrorCodeCommand, byName["dns"].Error)
+	assert.True(t, byName["api"].Skipped)
+	assert.Equal(t, ErrorCodeSkipped, byName["api"].Error)
+	assert.Equal(t, `skipped: dependency "dns" failed`, byName["api"].ErrorMessage)
+	assert.Equal(t, `skipped: dependency "api" was skipped`, byName["smoke"].ErrorMessage)
+	assert.Equal(t, ErrorCodeSuccess, byName["other"].Error, "names outside the run are not waited for")
+
+	formatted := app.formatResult(byName["api"])
+	assert.Equal(t, true, formatted["skipped"])
+
+	// A cycle is reported as skipped instead of hanging
+	results = app.runChecks([]Check{
+		{Name: "a", Input: "echo a", InputOptions: InputOptions{DependsOn: []string{"b"}}},
+		{Name: "b", Input: "echo b", InputOptions: InputOptions{DependsOn: []string{"a"}}},
+	})
+	assert.Equal(t, "skipped: dependency cycle", results[0].ErrorMessage)
+	assert.True(t, results[1].Skipped)
+}
+
+// TestCheckDependencies tests the unknown names and cycles reported before a run
+func TestCheckDependencies(t *testing.T) {
+	checks := []Check{
+		{Name: "db", Input: "db:5432"},
+		{Name: "migrate", Input: "echo migrate", InputOptions: InputOptions{DependsOn: []string{"db"}}},
+		{Name: "api", Input: "echo api", InputOptions: InputOptions{DependsOn: []string{"dns"}}},
+	}
+	assert.Equal(t, []Diagnostic{{Message: `input api: dependsOn "dns" matches no input name`}}, checkDependencies(checks))
+
+	checks[0].DependsOn = []string{"migrate"}
+	checks = append(checks, Check{Name: "smoke", Input: "echo smoke", InputOptions: InputOptions{DependsOn: []string{"migrate"}}})
+	assert.Equal(t, "dependency cycle: db, migrate, smoke can never run", checkDependencies(checks)[1].Message)
+}
+
+// TestRunAndReportSkipped tests that skipped checks are listed but not
+// counted as failures
+func TestRunAndReportSkipped(t *testing.T) {
+	app := NewApp(&Config{})
+	app.logger = logging.MustGetLogger("mcall")
+
+	var summary bytes.Buffer
+	err := app.runAndReport([]Check{
+		{Name: "db", Input: "exit 1", Type: RequestTypeShell},
+		{Name: "migrate", Input: "echo ok", Type: RequestTypeShell, InputOptions: InputOptions{DependsOn: []string{"db"}}},
+		{Name: "cache", Input: "echo ok", Type: RequestTypeShell},
+	}, app.exitPolicy, &summary)
+	assert.Equal(t, "mcall: 1 of 2 checks failed (fail-on any): db; 1 skipped: migrate\n", summary.String())
+	var failure *CheckFailure
+	assert.ErrorAs(t, err, &failure)
+	assert.Equal(t, 2, failure.Total)
+}
@@ -0,0 +1,1050 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+)
+
+// Expect expressions
+//
+// An expect is either a boolean expression such as
+//
+//	status == 200 && body contains "ok"
+//	count >= 3 || (duration < 500ms && !regex(body, "v[0-9]+"))
+//
+// or a legacy list of substring patterns joined by "|" ("200|301|302"), where
+// each alternative may itself be an expression ("$count < 10|$count > 100")
+// and "!pattern" asserts that the response does not contain pattern.
+//
+// JSON paths such as $.status, $.items[0].name or $.pods[*].ready refer to
+// the fetched document parsed as JSON (stdout for commands, so
+// "kubectl get -o json" can be asserted on directly).
+
+// expectIdentifiers lists the values an expression can refer to
+var expectIdentifiers = map[string]bool{
+	"body":     true,
+	"stdout":   true,
+	"stderr":   true,
+	"status":   true,
+	"exitCode": true,
+	"duration": true,
+	"count":    true,
+	"$count":   true,
+}
+
+// expectFunctions maps function names onto their argument count
+var expectFunctions = map[string]int{
+	"regex":    2,
+	"contains": 2,
+	"len":      1,
+	"header":   1,
+}
+
+// expectContext is the fetched data an expression is evaluated against
+type expectContext struct {
+	Body     string
+	Stdout   string
+	Stderr   string
+	Status   int
+	ExitCode int
+	Duration time.Duration
+	Headers  http.Header
+
+	document    interface{} // parsed JSON, loaded on first use
+	documentOK  bool
+	documentErr error
+}
+
+// newExpectContext builds the evaluation context for a fetched document
+func newExpectContext(doc ResultDoc, duration time.Duration) *expectContext {
+	return &expectContext{
+		Body:     doc.Raw,
+		Stdout:   doc.Stdout,
+		Stderr:   doc.Stderr,
+		Status:   doc.StatusCode,
+		ExitCode: doc.ExitCode,
+		Duration: duration,
+		Headers:  doc.Headers,
+	}
+}
+
+// count is the numeric value of the trimmed body, or its number of non-empty lines
+func (ctx *expectContext) count() float64 {
+	trimmed := strings.TrimSpace(ctx.Body)
+	if n, err := strconv.ParseFloat(trimmed, 64); err == nil {
+		return n
+	}
+	lines := 0
+	for _, line := range strings.Split(trimmed, "\n") {
+		if strings.TrimSpace(line) != "" {
+			lines++
+		}
+	}
+	return float64(lines)
+}
+
+// json parses the fetched document as JSON, preferring stdout for commands
+// so stderr noise doesn't break parsing
+func (ctx *expectContext) json() (interface{}, error) {
+	if ctx.documentOK || ctx.documentErr != nil {
+		return ctx.document, ctx.documentErr
+	}
+	source := ctx.Body
+	if ctx.Stdout != "" {
+		source = ctx.Stdout
+	}
+	if err := json.Unmarshal([]byte(source), &ctx.document); err != nil {
+		ctx.documentErr = fmt.Errorf("response is not valid JSON: %w", err)
+		return nil, ctx.documentErr
+	}
+	ctx.documentOK = true
+	return ctx.document, nil
+}
+
+// ExpectProgram is a compiled expect
+type ExpectProgram struct {
+	source string
+	expr   exprNode     // set for whole-expression expects
+	terms  []expectTerm // set for legacy "|" separated expects
+}
+
+// expectTerm is one alternative of a legacy expect
+type expectTerm struct {
+	expr    exprNode
+	pattern string
+	negated bool
+}
+
+// compileExpect parses an expect, returning a nil program for an empty expect
+func compileExpect(expect string) (*ExpectProgram, error) {
+	expect = strings.TrimSpace(expect)
+	if expect == "" {
+		return nil, nil
+	}
+
+	prog := &ExpectProgram{source: expect}
+	// A leading JSON path is never a substring, so report its parse errors
+	if isExpression(expect) || strings.HasPrefix(expect, "$.") || strings.HasPrefix(expect, "$[") {
+		expr, err := parseExpression(expect)
+		if err != nil {
+			return nil, err
+		}
+		prog.expr = expr
+		return prog, nil
+	}
+
+	for _, alternative := range strings.Split(expect, "|") {
+		alternative = strings.TrimSpace(alternative)
+		if isExpression(alternative) {
+			expr, err := parseExpression(alternative)
+			if err != nil {
+				return nil, err
+			}
+			prog.terms = append(prog.terms, expectTerm{expr: expr, pattern: alternative})
+			continue
+		}
+		if strings.HasPrefix(alternative, "!") {
+			prog.terms = append(prog.terms, expectTerm{pattern: strings.TrimPrefix(alternative, "!"), negated: true})
+		} else {
+			prog.terms = append(prog.terms, expectTerm{pattern: alternative})
+		}
+	}
+
+	return prog, nil
+}
+
+// Eval returns nil when the fetched data satisfies the expect
+func (p *ExpectProgram) Eval(ctx *expectContext) error {
+	if p.expr != nil {
+		ok, err := evalBool(p.expr, ctx)
+		if err != nil {
+			return fmt.Errorf("expect: %s: %w", p.source, err)
+		}
+		if !ok {
+			return fmt.Errorf("expect: %s but got: %s", p.source, ctx.Body)
+		}
+		return nil
+	}
+
+	var lastErr error
+	for _, term := range p.terms {
+		switch {
+		case term.expr != nil:
+			ok, err := evalBool(term.expr, ctx)
+			if err != nil {
+				lastErr = fmt.Errorf("expect: %s: %w", term.pattern, err)
+				continue
+			}
+			if ok {
+				return nil
+			}
+			lastErr = fmt.Errorf("expect: %s but got: %s", term.pattern, ctx.Body)
+		case term.negated:
+			if !strings.Contains(ctx.Body, term.pattern) {
+				return nil
+			}
+			lastErr = fmt.Errorf("expect: not %s but got: %s", term.pattern, ctx.Body)
+		default:
+			if strings.Contains(ctx.Body, term.pattern) {
+				return nil
+			}
+			lastErr = fmt.Errorf("expect: %s but got: %s", term.pattern, ctx.Body)
+		}
+	}
+	return lastErr
+}
+
+// isExpression reports whether an expect is written in the expression
+// language rather than as a plain substring: it must tokenize, refer to a
+// known identifier or function, and use an operator.
+func isExpression(expect string) bool {
+	tokens, err := tokenizeExpect(expect)
+	if err != nil {
+		return false
+	}
+
+	known, operator := false, false
+	for i, tok := range tokens {
+		switch tok.kind {
+		case tokenPath:
+			known = true
+		case tokenIdent:
+			if expectIdentifiers[tok.text] {
+				known = true
+			}
+			if _, ok := expectFunctions[tok.text]; ok && i+1 < len(tokens) && tokens[i+1].text == "(" {
+				known, operator = true, true
+			}
+			if tok.text == "contains" || tok.text == "matches" {
+				operator = true
+			}
+		case tokenOperator:
+			if tok.text != "!" && tok.text != "(" && tok.text != ")" && tok.text != "," {
+				operator = true
+			}
+		}
+	}
+	return known && operator
+}
+
+// Tokenizer
+
+type tokenKind int
+
+const (
+	tokenEOF tokenKind = iota
+	tokenIdent
+	tokenNumber
+	tokenDuration
+	tokenString
+	tokenOperator
+	tokenPath
+)
+
+type token struct {
+	kind tokenKind
+	text string
+	pos  int
+}
+
+// tokenizeExpect splits an expression into tokens
+func tokenizeExpect(src string) ([]token, error) {
+	var tokens []token
+	runes := []rune(src)
+
+	for i := 0; i < len(runes); {
+		r := runes[i]
+		switch {
+		case unicode.IsSpace(r):
+			i++
+		case r == '"' || r == '\'':
+			start := i
+			i++
+			var sb strings.Builder
+			for i < len(runes) && runes[i] != r {
+				if runes[i] == '\\' && i+1 < len(runes) {
+					i++
+					switch runes[i] {
+					case 'n':
+						sb.WriteRune('\n')
+					case 't':
+						sb.WriteRune('\t')
+					case 'r':
+						sb.WriteRune('\r')
+					default:
+						sb.WriteRune(runes[i])
+					}
+				} else {
+					sb.WriteRune(runes[i])
+				}
+				i++
+			}
+			if i >= len(runes) {
+				return nil, fmt.Errorf("unterminated string starting at column %d", start+1)
+			}
+			i++
+			tokens = append(tokens, token{kind: tokenString, text: sb.String(), pos: start})
+		case unicode.IsDigit(r) || (r == '-' && i+1 < len(runes) && unicode.IsDigit(runes[i+1]) && precedesOperand(tokens)):
+			start := i
+			i++
+			for i < len(runes) && (unicode.IsDigit(runes[i]) || runes[i] == '.') {
+				i++
+			}
+			kind := tokenNumber
+			unitStart := i
+			for i < len(runes) && unicode.IsLetter(runes[i]) {
+				i++
+			}
+			if i > unitStart {
+				if _, err := time.ParseDuration(string(runes[start:i])); err != nil {
+					return nil, fmt.Errorf("invalid duration %q at column %d", string(runes[start:i]), start+1)
+				}
+				kind = tokenDuration
+			}
+			tokens = append(tokens, token{kind: kind, text: string(runes[start:i]), pos: start})
+		case r == '$' && (i+1 == len(runes) || runes[i+1] == '.' || runes[i+1] == '['):
+			start := i
+			end, err := scanJSONPath(runes, i)
+			if err != nil {
+				return nil, err
+			}
+			i = end
+			tokens = append(tokens, token{kind: tokenPath, text: string(runes[start:i]), pos: start})
+		case unicode.IsLetter(r) || r == '_' || r == '$':
+			start := i
+			i++
+			for i < len(runes) && isIdentRune(runes[i]) {
+				i++
+			}
+			tokens = append(tokens, token{kind: tokenIdent, text: string(runes[start:i]), pos: start})
+		default:
+			start := i
+			two := ""
+			if i+1 < len(runes) {
+				two = string(runes[i : i+2])
+			}
+			switch {
+			case two == "==" || two == "!=" || two == "<=" || two == ">=" || two == "&&" || two == "||":
+				tokens = append(tokens, token{kind: tokenOperator, text: two, pos: start})
+				i += 2
+			case strings.ContainsRune("<>!(),", r):
+				tokens = append(tokens, token{kind: tokenOperator, text: string(r), pos: start})
+				i++
+			default:
+				return nil, fmt.Errorf("unexpected character %q at column %d", r, start+1)
+			}
+		}
+	}
+
+	tokens = append(tokens, token{kind: tokenEOF, pos: len(runes)})
+	return tokens, nil
+}
+
+// isIdentRune reports whether r may continue an identifier
+func isIdentRune(r rune) bool {
+	return unicode.IsLetter(r) || unicode.IsDigit(r) || r == '_' || r == '$'
+}
+
+// precedesOperand reports whether the next token starts an operand, so a
+// leading '-' belongs to a negative number
+func precedesOperand(tokens []token) bool {
+	if len(tokens) == 0 {
+		return true
+	}
+	last := tokens[len(tokens)-1]
+	return last.kind == tokenOperator && last.text != ")"
+}
+
+// Parser
+
+type exprNode interface {
+	eval(ctx *expectContext) (interface{}, error)
+}
+
+type literalNode struct {
+	value interface{}
+}
+
+type identNode struct {
+	name string
+}
+
+type pathNode struct {
+	source string
+	steps  []pathStep
+}
+
+type notNode struct {
+	operand exprNode
+}
+
+type binaryNode struct {
+	op          string
+	left, right exprNode
+}
+
+type callNode struct {
+	name  string
+	args  []exprNode
+	regex *regexp.Regexp // precompiled when the pattern is a literal
+}
+
+type exprParser struct {
+	src    string
+	tokens []token
+	pos    int
+}
+
+// parseExpression compiles an expression, reporting the column of any error
+func parseExpression(src string) (exprNode, error) {
+	tokens, err := tokenizeExpect(src)
+	if err != nil {
+		return nil, fmt.Errorf("invalid expect %q: %w", src, err)
+	}
+
+	p := &exprParser{src: src, tokens: tokens}
+	node, err := p.parseOr()
+	if err == nil && p.peek().kind != tokenEOF {
+		err = p.errorf("unexpected %q", p.peek().text)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("invalid expect %q: %w", src, err)
+	}
+	return node, nil
+}
+
+func (p *exprParser) peek() token {
+	return p.tokens[p.pos]
+}
+
+func (p *exprParser) next() token {
+	tok := p.tokens[p.pos]
+	if tok.kind != tokenEOF {
+		p.pos++
+	}
+	return tok
+}
+
+func (p *exprParser) errorf(format string, args ...interface{}) error {
+	return fmt.Errorf("%s at column %d", fmt.Sprintf(format, args...), p.peek().pos+1)
+}
+
+func (p *exprParser) expect(text string) error {
+	if p.peek().text != text || p.peek().kind == tokenString {
+		if p.peek().kind == tokenEOF {
+			return p.errorf("expected %q but expression ended", text)
+		}
+		return p.errorf("expected %q but found %q", text, p.peek().text)
+	}
+	p.next()
+	return nil
+}
+
+func (p *exprParser) isOp(texts ...string) bool {
+	tok := p.peek()
+	if tok.kind != tokenOperator && tok.kind != tokenIdent {
+		return false
+	}
+	for _, text := range texts {
+		if tok.text == text {
+			return true
+		}
+	}
+	return false
+}
+
+// or := and ( ("||" | "or") and )*
+func (p *exprParser) parseOr() (exprNode, error) {
+	left, err := p.parseAnd()
+	if err != nil {
+		return nil, err
+	}
+	for p.isOp("||", "or") {
+		p.next()
+		right, err := p.parseAnd()
+		if err != nil {
+			return nil, err
+		}
+		left = &binaryNode{op: "||", left: left, right: right}
+	}
+	return left, nil
+}
+
+// and := unary ( ("&&" | "and") unary )*
+func (p *exprParser) parseAnd() (exprNode, error) {
+	left, err := p.parseUnary()
+	if err != nil {
+		return nil, err
+	}
+	for p.isOp("&&", "and") {
+		p.next()
+		right, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		left = &binaryNode{op: "&&", left: left, right: right}
+	}
+	return left, nil
+}
+
+// unary := ("!" | "not") unary | comparison
+func (p *exprParser) parseUnary() (exprNode, error) {
+	if p.isOp("!", "not") {
+		p.next()
+		operand, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		return &notNode{operand: operand}, nil
+	}
+	return p.parseComparison()
+}
+
+// comparison := operand ( op operand )?
+func (p *exprParser) parseComparison() (exprNode, error) {
+	left, err := p.parseOperand()
+	if err != nil {
+		return nil, err
+	}
+	if p.isOp("==", "!=", "<", "<=", ">", ">=", "contains", "matches") {
+		op := p.next().text
+		right, err := p.parseOperand()
+		if err != nil {
+			return nil, err
+		}
+		if op == "matches" {
+			// Compile literal patterns now so bad regexes fail at load time
+			call := &callNode{name: "regex", args: []exprNode{left, right}}
+			if err := call.precompile(); err != nil {
+				return nil, err
+			}
+			return call, nil
+		}
+		return &binaryNode{op: op, left: left, right: right}, nil
+	}
+	return left, nil
+}
+
+// operand := literal | identifier | call | "(" or ")"
+func (p *exprParser) parseOperand() (exprNode, error) {
+	tok := p.peek()
+	switch tok.kind {
+	case tokenNumber:
+		p.next()
+		n, err := strconv.ParseFloat(tok.text, 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid number %q at column %d", tok.text, tok.pos+1)
+		}
+		return &literalNode{value: n}, nil
+	case tokenDuration:
+		p.next()
+		d, _ := time.ParseDuration(tok.text)
+		return &literalNode{value: d}, nil
+	case tokenString:
+		p.next()
+		return &literalNode{value: tok.text}, nil
+	case tokenPath:
+		p.next()
+		steps, err := parseJSONPath(tok.text)
+		if err != nil {
+			return nil, fmt.Errorf("invalid path %q at column %d: %w", tok.text, tok.pos+1, err)
+		}
+		return &pathNode{source: tok.text, steps: steps}, nil
+	case tokenIdent:
+		p.next()
+		switch tok.text {
+		case "true":
+			return &literalNode{value: true}, nil
+		case "false":
+			return &literalNode{value: false}, nil
+		case "null":
+			return &literalNode{value: nil}, nil
+		}
+		if arity, ok := expectFunctions[tok.text]; ok && p.peek().text == "(" {
+			return p.parseCall(tok, arity)
+		}
+		if !expectIdentifiers[tok.text] {
+			return nil, fmt.Errorf("unknown identifier %q at column %d", tok.text, tok.pos+1)
+		}
+		return &identNode{name: tok.text}, nil
+	case tokenOperator:
+		if tok.text == "(" {
+			p.next()
+			node, err := p.parseOr()
+			if err != nil {
+				return nil, err
+			}
+			if err := p.expect(")"); err != nil {
+				return nil, err
+			}
+			return node, nil
+		}
+	case tokenEOF:
+		return nil, p.errorf("expected a value but expression ended")
+	}
+	return nil, p.errorf("unexpected %q", tok.text)
+}
+
+// call := name "(" args ")"
+func (p *exprParser) parseCall(name token, arity int) (exprNode, error) {
+	p.next() // (
+	call := &callNode{name: name.text}
+	for p.peek().text != ")" || p.peek().kind == tokenString {
+		if len(call.args) > 0 {
+			if err := p.expect(","); err != nil {
+				return nil, err
+			}
+		}
+		arg, err := p.parseOr()
+		if err != nil {
+			return nil, err
+		}
+		call.args = append(call.args, arg)
+	}
+	if err := p.expect(")"); err != nil {
+		return nil, err
+	}
+	if len(call.args) != arity {
+		return nil, fmt.Errorf("%s() takes %d argument(s) but got %d at column %d", name.text, arity, len(call.args), name.pos+1)
+	}
+	if err := call.precompile(); err != nil {
+		return nil, err
+	}
+	return call, nil
+}
+
+// precompile compiles a literal regex pattern so errors surface at load time
+func (c *callNode) precompile() error {
+	if c.name != "regex" {
+		return nil
+	}
+	if lit, ok := c.args[1].(*literalNode); ok {
+		pattern, ok := lit.value.(string)
+		if !ok {
+			return fmt.Errorf("regex pattern must be a string")
+		}
+		re, err := regexp.Compile(pattern)
+		if err != nil {
+			return fmt.Errorf("invalid regex %q: %w", pattern, err)
+		}
+		c.regex = re
+	}
+	return nil
+}
+
+// Evaluation
+
+func (n *literalNode) eval(ctx *expectContext) (interface{}, error) {
+	return n.value, nil
+}
+
+func (n *identNode) eval(ctx *expectContext) (interface{}, error) {
+	switch n.name {
+	case "body":
+		return ctx.Body, nil
+	case "stdout":
+		return ctx.Stdout, nil
+	case "stderr":
+		return ctx.Stderr, nil
+	case "status":
+		return float64(ctx.Status), nil
+	case "exitCode":
+		return float64(ctx.ExitCode), nil
+	case "duration":
+		return ctx.Duration, nil
+	case "count", "$count":
+		return ctx.count(), nil
+	}
+	return nil, fmt.Errorf("unknown identifier %q", n.name)
+}
+
+func (n *pathNode) eval(ctx *expectContext) (interface{}, error) {
+	doc, err := ctx.json()
+	if err != nil {
+		return nil, err
+	}
+	return resolveJSONPath(doc, n.steps), nil
+}
+
+func (n *notNode) eval(ctx *expectContext) (interface{}, error) {
+	v, err := evalBool(n.operand, ctx)
+	if err != nil {
+		return nil, err
+	}
+	return !v, nil
+}
+
+func (n *binaryNode) eval(ctx *expectContext) (interface{}, error) {
+	switch n.op {
+	case "&&", "||":
+		left, err := evalBool(n.left, ctx)
+		if err != nil {
+			return nil, err
+		}
+		if (n.op == "&&" && !left) || (n.op == "||" && left) {
+			return left, nil
+		}
+		return evalBool(n.right, ctx)
+	}
+
+	left, err := n.left.eval(ctx)
+	if err != nil {
+		return nil, err
+	}
+	right, err := n.right.eval(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	if n.op == "contains" {
+		if items, ok := left.([]interface{}); ok {
+			for _, item := range items {
+				if eq, err := compareValues("==", item, right); err == nil && eq {
+					return true, nil
+				}
+			}
+			return false, nil
+		}
+		l, lok := left.(string)
+		r, rok := right.(string)
+		if !lok || !rok {
+			return nil, fmt.Errorf("contains needs strings but got %v and %v", left, right)
+		}
+		return strings.Contains(l, r), nil
+	}
+	return compareValues(n.op, left, right)
+}
+
+func (c *callNode) eval(ctx *expectContext) (interface{}, error) {
+	args := make([]interface{}, len(c.args))
+	for i, arg := range c.args {
+		v, err := arg.eval(ctx)
+		if err != nil {
+			return nil, err
+		}
+		args[i] = v
+	}
+
+	switch c.name {
+	case "regex":
+		s, ok := args[0].(string)
+		if !ok {
+			return nil, fmt.Errorf("regex needs a string but got %v", args[0])
+		}
+		re := c.regex
+		if re == nil {
+			pattern, ok := args[1].(string)
+			if !ok {
+				return nil, fmt.Errorf("regex pattern must be a string but got %v", args[1])
+			}
+			var err error
+			if re, err = regexp.Compile(pattern); err != nil {
+				return nil, fmt.Errorf("invalid regex %q: %w", pattern, err)
+			}
+		}
+		return re.MatchString(s), nil
+	case "contains":
+		s, sok := args[0].(string)
+		sub, subok := args[1].(string)
+		if !sok || !subok {
+			return nil, fmt.Errorf("contains needs strings but got %v and %v", args[0], args[1])
+		}
+		return strings.Contains(s, sub), nil
+	case "len":
+		switch v := args[0].(type) {
+		case string:
+			return float64(len(v)), nil
+		case []interface{}:
+			return float64(len(v)), nil
+		case map[string]interface{}:
+			return float64(len(v)), nil
+		}
+		return nil, fmt.Errorf("len needs a string, array or object but got %v", args[0])
+	case "header":
+		name, ok := args[0].(string)
+		if !ok {
+			return nil, fmt.Errorf("header name must be a string but got %v", args[0])
+		}
+		return ctx.Headers.Get(name), nil
+	}
+	return nil, fmt.Errorf("unknown function %s", c.name)
+}
+
+// evalBool evaluates a node that must produce true or false
+func evalBool(node exprNode, ctx *expectContext) (bool, error) {
+	v, err := node.eval(ctx)
+	if err != nil {
+		return false, err
+	}
+	b, ok := v.(bool)
+	if !ok {
+		return false, fmt.Errorf("expected true or false but got %v", v)
+	}
+	return b, nil
+}
+
+// compareValues compares numbers, durations, strings and booleans. A number
+// compared with a duration is taken as milliseconds.
+func compareValues(op string, left, right interface{}) (bool, error) {
+	if d, ok := left.(time.Duration); ok {
+		if n, ok := right.(float64); ok {
+			right = time.Duration(n * float64(time.Millisecond))
+		}
+		left = d
+	} else if d, ok := right.(time.Duration); ok {
+		if n, ok := left.(float64); ok {
+			left = time.Duration(n * float64(time.Millisecond))
+		}
+		right = d
+	}
+
+	var cmp int
+	switch l := left.(type) {
+	case float64:
+		r, ok := right.(float64)
+		if !ok {
+			return false, mismatch(op, left, right)
+		}
+		cmp = compareNumbers(l, r)
+	case time.Duration:
+		r, ok := right.(time.Duration)
+		if !ok {
+			return false, mismatch(op, left, right)
+		}
+		cmp = compareNumbers(float64(l), float64(r))
+	case string:
+		r, ok := right.(string)
+		if !ok {
+			// Allow comparing numeric output with a number
+			if rn, isNum := right.(float64); isNum {
+				if ln, err := strconv.ParseFloat(strings.TrimSpace(l), 64); err == nil {
+					cmp = compareNumbers(ln, rn)
+					break
+				}
+			}
+			return false, mismatch(op, left, right)
+		}
+		cmp = strings.Compare(l, r)
+	case bool:
+		r, ok := right.(bool)
+		if !ok || (op != "==" && op != "!=") {
+			return false, mismatch(op, left, right)
+		}
+		if l == r {
+			cmp = 0
+		} else {
+			cmp = 1
+		}
+	case nil:
+		if op != "==" && op != "!=" {
+			return false, mismatch(op, left, right)
+		}
+		if right == nil {
+			cmp = 0
+		} else {
+			cmp = 1
+		}
+	default:
+		return false, mismatch(op, left, right)
+	}
+
+	switch op {
+	case "==":
+		return cmp == 0, nil
+	case "!=":
+		return cmp != 0, nil
+	case "<":
+		return cmp < 0, nil
+	case "<=":
+		return cmp <= 0, nil
+	case ">":
+		return cmp > 0, nil
+	case ">=":
+		return cmp >= 0, nil
+	}
+	return false, fmt.Errorf("unknown operator %s", op)
+}
+
+func compareNumbers(l, r float64) int {
+	switch {
+	case l < r:
+		return -1
+	case l > r:
+		return 1
+	}
+	return 0
+}
+
+func mismatch(op string, left, right interface{}) error {
+	return fmt.Errorf("cannot compare %v %s %v", left, op, right)
+}
+
+// JSON paths
+
+// pathStep is one ".key", "[index]" or wildcard step of a JSON path
+type pathStep struct {
+	key      string
+	index    int
+	isIndex  bool
+	wildcard bool
+}
+
+// scanJSONPath returns the end of the JSON path starting at runes[start]
+func scanJSONPath(runes []rune, start int) (int, error) {
+	i := start + 1
+	for i < len(runes) {
+		switch runes[i] {
+		case '.':
+			i++
+			keyStart := i
+			if i < len(runes) && runes[i] == '*' {
+				i++
+				continue
+			}
+			for i < len(runes) && (isIdentRune(runes[i]) || runes[i] == '-') {
+				i++
+			}
+			if i == keyStart {
+				return 0, fmt.Errorf("expected a key after \".\" at column %d", i+1)
+			}
+		case '[':
+			var quote rune
+			i++
+			for i < len(runes) && (quote != 0 || runes[i] != ']') {
+				switch {
+				case quote != 0 && runes[i] == quote:
+					quote = 0
+				case quote == 0 && (runes[i] == '"' || runes[i] == '\''):
+					quote = runes[i]
+				}
+				i++
+			}
+			if i >= len(runes) {
+				return 0, fmt.Errorf("unterminated \"[\" in path at column %d", start+1)
+			}
+			i++
+		default:
+			return i, nil
+		}
+	}
+	return i, nil
+}
+
+// parseJSONPath splits a path such as $.items[0]["name"] into steps
+func parseJSONPath(path string) ([]pathStep, error) {
+	var steps []pathStep
+	rest := strings.TrimPrefix(path, "$")
+	for rest != "" {
+		switch rest[0] {
+		case '.':
+			rest = rest[1:]
+			end := strings.IndexAny(rest, ".[")
+			if end < 0 {
+				end = len(rest)
+			}
+			key := rest[:end]
+			rest = rest[end:]
+			if key == "*" {
+				steps = append(steps, pathStep{wildcard: true})
+			} else {
+				steps = append(steps, pathStep{key: key})
+			}
+		case '[':
+			end := closingBracket(rest)
+			inner := strings.TrimSpace(rest[1:end])
+			rest = rest[end+1:]
+			switch {
+			case inner == "*":
+				steps = append(steps, pathStep{wildcard: true})
+			case len(inner) >= 2 && (inner[0] == '"' || inner[0] == '\'') && inner[len(inner)-1] == inner[0]:
+				steps = append(steps, pathStep{key: inner[1 : len(inner)-1]})
+			default:
+				index, err := strconv.Atoi(inner)
+				if err != nil {
+					return nil, fmt.Errorf("invalid index %q", inner)
+				}
+				steps = append(steps, pathStep{index: index, isIndex: true})
+			}
+		default:
+			return nil, fmt.Errorf("unexpected %q", rest)
+		}
+	}
+	return steps, nil
+}
+
+// closingBracket returns the index of the "]" closing the "[" at s[0]
+func closingBracket(s string) int {
+	var quote byte
+	for i := 1; i < len(s); i++ {
+		switch {
+		case quote != 0 && s[i] == quote:
+			quote = 0
+		case quote == 0 && (s[i] == '"' || s[i] == '\''):
+			quote = s[i]
+		case quote == 0 && s[i] == ']':
+			return i
+		}
+	}
+	return len(s) - 1
+}
+
+// resolveJSONPath walks a parsed JSON document, returning nil for missing
+// paths. Negative indexes count from the end and wildcards collect the
+// remaining path from every element into an array.
+func resolveJSONPath(value interface{}, steps []pathStep) interface{} {
+	for i, step := range steps {
+		switch {
+		case step.wildcard:
+			var elements []interface{}
+			switch v := value.(type) {
+			case []interface{}:
+				elements = v
+			case map[string]interface{}:
+				keys := make([]string, 0, len(v))
+				for key := range v {
+					keys = append(keys, key)
+				}
+				sort.Strings(keys)
+				for _, key := range keys {
+					elements = append(elements, v[key])
+				}
+			default:
+				return nil
+			}
+			collected := make([]interface{}, 0, len(elements))
+			for _, element := range elements {
+				if resolved := resolveJSONPath(element, steps[i+1:]); resolved != nil {
+					collected = append(collected, resolved)
+				}
+			}
+			return collected
+		case step.isIndex:
+			items, ok := value.([]interface{})
+			if !ok {
+				return nil
+			}
+			index := step.index
+			if index < 0 {
+				index += len(items)
+			}
+			if index < 0 || index >= len(items) {
+				return nil
+			}
+			value = items[index]
+		default:
+			object, ok := value.(map[string]interface{})
+			if !ok {
+				return nil
+			}
+			value = object[step.key]
+		}
+	}
+	return value
+}
@@ -0,0 +1,239 @@
+package main
+
+import (
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/op/go-logging"
+	"github.com/stretchr/testify/assert"
+)
+
+// TestExpectExpressions tests evaluation of expression expects
+func TestExpectExpressions(t *testing.T) {
+	ctx := &expectContext{
+		Body:     "service ok, version v1.4.2",
+		Status:   200,
+		Duration: 120 * time.Millisecond,
+		Headers:  http.Header{"Content-Type": []string{"application/json"}},
+	}
+
+	tests := []struct {
+		expect string
+		pass   bool
+	}{
+		{expect: `status == 200 && body contains "ok"`, pass: true},
+		{expect: `status == 200 && body contains "down"`, pass: false},
+		{expect: `status != 200 || body contains "ok"`, pass: true},
+		{expect: `status >= 200 and status < 300`, pass: true},
+		{expect: `duration < 500ms`, pass: true},
+		{expect: `duration < 100ms`, pass: false},
+		{expect: `duration <= 120`, pass: true},
+		{expect: `regex(body, "v[0-9]+\\.[0-9]+")`, pass: true},
+		{expect: `body matches "^service"`, pass: true},
+		{expect: `!regex(body, "error")`, pass: true},
+		{expect: `not (status == 500)`, pass: true},
+		{expect: `len(body) > 10`, pass: true},
+		{expect: `header("Content-Type") == "application/json"`, pass: true},
+		{expect: `contains(body, "v1") && (status == 404 || duration < 1s)`, pass: true},
+		// && binds tighter than ||
+		{expect: `status == 200 || status == 500 && body contains "nope"`, pass: true},
+		{expect: `(status == 200 || status == 500) && body contains "nope"`, pass: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.expect, func(t *testing.T) {
+			prog, err := compileExpect(tt.expect)
+			assert.NoError(t, err)
+			assert.NotNil(t, prog.expr, "should compile as an expression")
+
+			if tt.pass {
+				assert.NoError(t, prog.Eval(ctx))
+			} else {
+				assert.Error(t, prog.Eval(ctx))
+			}
+		})
+	}
+}
+
+// TestExpectCount tests count comparisons, including the $count alias
+func TestExpectCount(t *testing.T) {
+	tests := []struct {
+		body   string
+		expect string
+		pass   bool
+	}{
+		{body: "5\n", expect: "$count < 10", pass: true},
+		{body: "10\n", expect: "$count < 10", pass: false},
+		{body: "10\n", expect: "count <= 10", pass: true},
+		{body: "10\n", expect: "count == 10", pass: true},
+		{body: "15", expect: "10 > $count", pass: false},
+		{body: "5", expect: "10 > $count", pass: true},
+		{body: "a\nb\n\nc\n", expect: "count >= 3", pass: true},
+		{body: "a\nb\n", expect: "count >= 3", pass: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.expect+"/"+tt.body, func(t *testing.T) {
+			prog, err := compileExpect(tt.expect)
+			assert.NoError(t, err)
+
+			err = prog.Eval(&expectContext{Body: tt.body})
+			if tt.pass {
+				assert.NoError(t, err)
+			} else {
+				assert.Error(t, err)
+			}
+		})
+	}
+}
+
+// TestExpectLegacyPatterns tests that substring expects keep working
+func TestExpectLegacyPatterns(t *testing.T) {
+	tests := []struct {
+		body   string
+		expect string
+		pass   bool
+	}{
+		{body: "Escape character is '^]'.", expect: "Escape character is", pass: true},
+		{body: "hello world", expect: "hello|goodbye", pass: true},
+		{body: "failure", expect: "success|ok|done", pass: false},
+		{body: "<html>302 Found</html>", expect: "200|301|302", pass: true},
+		{body: "all good", expect: "!error", pass: true},
+		{body: "150", expect: "$count < 10|$count > 100", pass: true},
+		{body: "50", expect: "$count < 10|$count > 100", pass: false},
+		{body: "the count is high", expect: "count is", pass: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.expect, func(t *testing.T) {
+			prog, err := compileExpect(tt.expect)
+			assert.NoError(t, err)
+
+			err = prog.Eval(&expectContext{Body: tt.body})
+			if tt.pass {
+				assert.NoError(t, err)
+			} else {
+				assert.Error(t, err)
+			}
+		})
+	}
+}
+
+// TestExpectParseErrors tests that malformed expressions fail to compile
+func TestExpectParseErrors(t *testing.T) {
+	tests := []struct {
+		expect  string
+		message string
+	}{
+		{expect: `status == `, message: "expression ended"},
+		{expect: `(status == 200`, message: `expected ")"`},
+		{expect: `status == 200 && bogus > 1`, message: `unknown identifier "bogus" at column 18`},
+		{expect: `regex(body, "[")`, message: "invalid regex"},
+		{expect: `regex(body)`, message: "takes 2 argument(s)"},
+		{expect: `status == 200 ok`, message: `unexpected "ok" at column 15`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.expect, func(t *testing.T) {
+			_, err := compileExpect(tt.expect)
+			assert.Error(t, err)
+			assert.Contains(t, err.Error(), tt.message)
+		})
+	}
+}
+
+// TestExpectTypeErrors tests that mismatched comparisons fail at evaluation
+func TestExpectTypeErrors(t *testing.T) {
+	prog, err := compileExpect(`body > true`)
+	assert.NoError(t, err)
+	assert.Error(t, prog.Eval(&expectContext{Body: "x"}))
+
+	prog, err = compileExpect(`status`)
+	assert.NoError(t, err)
+	assert.Nil(t, prog.expr, "a bare identifier is a substring pattern")
+}
+
+// TestExpectJSONPath tests assertions on JSON documents
+func TestExpectJSONPath(t *testing.T) {
+	body := `{"status": "UP", "items": [{"name": "a", "ready": true}, {"name": "b", "ready": false}],
+		"db": {"latencyMs": 42, "error": null}, "x-version": "1.2", "empty": []}`
+	ctx := &expectContext{Body: body, Status: 200}
+
+	tests := []struct {
+		expect string
+		pass   bool
+	}{
+		{expect: `$.status == "UP"`, pass: true},
+		{expect: `$.status == "DOWN"`, pass: false},
+		{expect: `len($.items) > 0`, pass: true},
+		{expect: `len($.empty) > 0`, pass: false},
+		{expect: `$.db.latencyMs < 200`, pass: true},
+		{expect: `$.db.latencyMs < 10`, pass: false},
+		{expect: `$.db.error == null`, pass: true},
+		{expect: `$.items[0].name == "a"`, pass: true},
+		{expect: `$.items[-1].name == "b"`, pass: true},
+		{expect: `$["x-version"] == "1.2"`, pass: true},
+		{expect: `$.x-version == "1.2"`, pass: true},
+		{expect: `$.items[*].name contains "b"`, pass: true},
+		{expect: `$.items[*].ready contains false`, pass: true},
+		{expect: `$.missing.path == "x"`, pass: false},
+		{expect: `status == 200 && $.status == "UP"`, pass: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.expect, func(t *testing.T) {
+			prog, err := compileExpect(tt.expect)
+			assert.NoError(t, err)
+			assert.NotNil(t, prog.expr, "should compile as an expression")
+
+			if tt.pass {
+				assert.NoError(t, prog.Eval(ctx))
+			} else {
+				assert.Error(t, prog.Eval(ctx))
+			}
+		})
+	}
+}
+
+// TestExpectJSONPathDocuments tests which output is parsed as JSON
+func TestExpectJSONPathDocuments(t *testing.T) {
+	prog, err := compileExpect(`$.kind == "PodList"`)
+	assert.NoError(t, err)
+
+	// Commands are asserted on stdout so stderr warnings don't break parsing
+	ctx := &expectContext{
+		Body:   "Warning: deprecated\n{\"kind\": \"PodList\"}",
+		Stdout: `{"kind": "PodList"}`,
+	}
+	assert.NoError(t, prog.Eval(ctx))
+
+	err = prog.Eval(&expectContext{Body: "<html>not json</html>"})
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "not valid JSON")
+
+	_, err = compileExpect(`$.items[0 == 1`)
+	assert.Error(t, err)
+	_, err = compileExpect(`$.items[x] == 1`)
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "invalid index")
+}
+
+// TestCompiledExpect tests that a parsed check carries its compiled expect
+// and that checks built directly compile theirs when they run
+func TestCompiledExpect(t *testing.T) {
+	app := NewApp(&Config{})
+	app.logger = logging.MustGetLogger("mcall")
+
+	checks := app.parseInputConfigs([]InputConfig{{Input: "echo hi", Expect: "count == 1"}, {Input: "pwd"}})
+	assert.NotNil(t, checks[0].ExpectProgram)
+	prog, err := checks[0].compiledExpect()
+	assert.NoError(t, err)
+	assert.Same(t, checks[0].ExpectProgram, prog)
+	prog, err = checks[1].compiledExpect()
+	assert.NoError(t, err)
+	assert.Nil(t, prog)
+
+	_, err = Check{Input: "echo hi", Expect: "count =="}.compiledExpect()
+	assert.Error(t, err)
+}
@@ -0,0 +1,196 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"reflect"
+	"strings"
+
+	"github.com/spf13/viper"
+	"gopkg.in/yaml.v3"
+)
+
+// EnvPrefix prefixes the environment variables that set config keys, so
+// MCALL_REQUEST_TIMEOUT sets request.timeout
+const EnvPrefix = "MCALL"
+
+// interpolate expands ${VAR}, ${VAR:-default} and ${file:/path} in value.
+// The default is used when the variable is unset or empty, or the file can't
+// be read, and may itself contain references. $${ is a literal ${.
+func interpolate(value string, lookupEnv func(string) (string, bool), readFile func(string) ([]byte, error)) (string, error) {
+	var out strings.Builder
+	for {
+		i := strings.Index(value, "${")
+		if i < 0 {
+			out.WriteString(value)
+			return out.String(), nil
+		}
+		if i > 0 && value[i-1] == '$' {
+			out.WriteString(value[:i-1])
+			out.WriteString("${")
+			value = value[i+2:]
+			continue
+		}
+		out.WriteString(value[:i])
+
+		// Find the closing brace, allowing references nested in the default
+		depth, end := 0, -1
+		for j := i + 2; j < len(value) && end < 0; j++ {
+			switch value[j] {
+			case '{':
+				depth++
+			case '}':
+				if depth == 0 {
+					end = j
+				}
+				depth--
+			}
+		}
+		if end < 0 {
+			return "", fmt.Errorf("unterminated reference in %q", value[i:])
+		}
+
+		expanded, err := resolveReference(value[i+2:end], lookupEnv, readFile)
+		if err != nil {
+			return "", err
+		}
+		out.WriteString(expanded)
+		value = value[end+1:]
+	}
+}
+
+// resolveReference resolves the inside of one ${...} reference
+func resolveReference(ref string, lookupEnv func(string) (string, bool), readFile func(string) ([]byte, error)) (string, error) {
+	name, def, hasDefault := ref, "", false
+	if i := strings.Index(ref, ":-"); i >= 0 {
+		name, def, hasDefault = ref[:i], ref[i+2:], true
+	}
+	fallback := func(err error) (string, error) {
+		if hasDefault {
+			return interpolate(def, lookupEnv, readFile)
+		}
+		return "", err
+	}
+
+	if path := strings.TrimPrefix(name, "file:"); path != name {
+		data, err := readFile(path)
+		if err != nil {
+			return fallback(fmt.Errorf("${file:%s}: %w", path, err))
+		}
+		return strings.TrimRight(string(data), "\r\n"), nil
+	}
+
+	if !validEnvName(name) {
+		return "", fmt.Errorf("invalid reference ${%s}", ref)
+	}
+	if value, ok := lookupEnv(name); ok && value != "" {
+		return value, nil
+	}
+	return fallback(fmt.Errorf("environment variable %s is not set", name))
+}
+
+// validEnvName reports whether name is a shell style variable name
+func validEnvName(name string) bool {
+	if name == "" {
+		return false
+	}
+	for i, r := range name {
+		switch {
+		case r == '_', r >= 'A' && r <= 'Z', r >= 'a' && r <= 'z':
+		case r >= '0' && r <= '9' && i > 0:
+		default:
+			return false
+		}
+	}
+	return true
+}
+
+// expandEnv interpolates a value from the process environment and files
+func expandEnv(value string) (string, error) {
+	return interpolate(value, os.LookupEnv, os.ReadFile)
+}
+
+// expandConfigNode interpolates every scalar value under node; keys are left
+// as written. Plain scalars are retyped after expansion so that
+// timeout: ${TIMEOUT:-3} is still a number. Failures are reported with the
+// key path and line of the value.
+func expandConfigNode(node *yaml.Node, path string, expand func(string) (string, error), report func(line int, format string, args ...interface{})) {
+	switch node.Kind {
+	case yaml.DocumentNode:
+		for _, child := range node.Content {
+			expandConfigNode(child, path, expand, report)
+		}
+	case yaml.SequenceNode:
+		for i, child := range node.Content {
+			expandConfigNode(child, fmt.Sprintf("%s[%d]", path, i), expand, report)
+		}
+	case yaml.MappingNode:
+		for i := 0; i+1 < len(node.Content); i += 2 {
+			name := node.Content[i].Value
+			if path != "" {
+				name = path + "." + name
+			}
+			expandConfigNode(node.Content[i+1], name, expand, report)
+		}
+	case yaml.ScalarNode:
+		if !strings.Contains(node.Value, "${") {
+			return
+		}
+		value, err := expand(node.Value)
+		if err != nil {
+			report(node.Line, "%s: %v", path, err)
+			return
+		}
+		node.Value = value
+		if node.Style&(yaml.DoubleQuotedStyle|yaml.SingleQuotedStyle|yaml.LiteralStyle|yaml.FoldedStyle) == 0 {
+			node.Tag = ""
+			node.Tag = node.ShortTag()
+		}
+	}
+}
+
+// envAliases are the shorter environment variable names some config keys
+// were documented under before every key got an MCALL_<SECTION>_<KEY> name.
+// They are bound as fallbacks: when both are set, MCALL_<SECTION>_<KEY> wins.
+var envAliases = map[string]string{
+	"worker.number":   "MCALL_WORKER_NUM",
+	"webserver.host":  "MCALL_HTTP_HOST",
+	"webserver.port":  "MCALL_HTTP_PORT",
+	"request.timeout": "MCALL_TIMEOUT",
+	"request.retries": "MCALL_RETRIES",
+	"response.format": "MCALL_FORMAT",
+	"exit.failOn":     "MCALL_FAIL_ON",
+	"exit.threshold":  "MCALL_THRESHOLD",
+}
+
+// bindConfigEnv binds MCALL_<SECTION>_<KEY>, then any alias from envAliases,
+// for every config key, so the environment can set keys the config file
+// leaves out. Lists of inputs can only be set in a file.
+func bindConfigEnv(v *viper.Viper, t reflect.Type, prefix string) {
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		key := field.Tag.Get("mapstructure")
+		if key == "" {
+			continue
+		}
+		if prefix != "" {
+			key = prefix + "." + key
+		}
+		switch {
+		case field.Type.Kind() == reflect.Struct:
+			bindConfigEnv(v, field.Type, key)
+		case field.Type.Kind() == reflect.Slice && field.Type.Elem().Kind() == reflect.Struct:
+		default:
+			binding := []string{key, configEnvName(key)}
+			if alias, ok := envAliases[key]; ok {
+				binding = append(binding, alias)
+			}
+			v.BindEnv(binding...)
+		}
+	}
+}
+
+// configEnvName is the environment variable that sets a config key
+func configEnvName(key string) string {
+	return EnvPrefix + "_" + strings.ToUpper(strings.ReplaceAll(key, ".", "_"))
+}
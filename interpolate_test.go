@@ -0,0 +1,143 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"gopkg.in/yaml.v3"
+)
+
+// TestInterpolate tests ${VAR}, defaults, ${file:...} and escaping
+func TestInterpolate(t *testing.T) {
+	env := map[string]string{"HOST": "db", "PORT": "5432", "EMPTY": ""}
+	lookupEnv := func(name string) (string, bool) {
+		value, ok := env[name]
+		return value, ok
+	}
+	readFile := func(path string) ([]byte, error) {
+		if path == "/run/secrets/token" {
+			return []byte("s3cret\n"), nil
+		}
+		return nil, os.ErrNotExist
+	}
+
+	tests := []struct {
+		value string
+		want  string
+		err   string
+	}{
+		{value: "plain", want: "plain"},
+		{value: "${HOST}:${PORT}", want: "db:5432"},
+		{value: "${MISSING:-localhost}", want: "localhost"},
+		{value: "${EMPTY:-fallback}", want: "fallback"},
+		{value: "${MISSING:-${HOST}}", want: "db"},
+		{value: "${MISSING:-}", want: ""},
+		{value: "Bearer ${file:/run/secrets/token}", want: "Bearer s3cret"},
+		{value: "${file:/missing:-none}", want: "none"},
+		{value: "$${HOST}", want: "${HOST}"},
+		{value: "${MISSING}", err: "environment variable MISSING is not set"},
+		{value: "${file:/missing}", err: "${file:/missing}: file does not exist"},
+		{value: "${HOST", err: `unterminated reference in "${HOST"`},
+		{value: "${1X}", err: "invalid reference ${1X}"},
+	}
+	for _, tt := range tests {
+		got, err := interpolate(tt.value, lookupEnv, readFile)
+		if tt.err != "" {
+			assert.EqualError(t, err, tt.err, tt.value)
+			continue
+		}
+		assert.NoError(t, err, tt.value)
+		assert.Equal(t, tt.want, got, tt.value)
+	}
+}
+
+// TestExpandConfigNode tests that values are expanded and retyped with their key path
+func TestExpandConfigNode(t *testing.T) {
+	var doc yaml.Node
+	assert.NoError(t, yaml.Unmarshal([]byte(`request:
+    timeout: ${TIMEOUT:-3}
+    subject: "${TIMEOUT:-3}"
+    inputs:
+        - input: http://localhost/
+          headers:
+              Authorization: Bearer ${TOKEN}
+`), &doc))
+
+	expand := func(value string) (string, error) {
+		return interpolate(value, func(string) (string, bool) { return "", false }, func(string) ([]byte, error) {
+			return nil, errors.New("no files")
+		})
+	}
+	var problems []string
+	expandConfigNode(&doc, "", expand, func(line int, format string, args ...interface{}) {
+		problems = append(problems, Diagnostic{File: "mcall.yaml", Line: line, Message: fmt.Sprintf(format, args...)}.String())
+	})
+
+	timeout := configNode(doc.Content[0], "request", "timeout")
+	assert.Equal(t, "3", timeout.Value)
+	assert.Equal(t, "!!int", timeout.Tag)
+	subject := configNode(doc.Content[0], "request", "subject")
+	assert.Equal(t, "!!str", subject.Tag, "quoted values stay strings")
+	assert.Equal(t, []string{"mcall.yaml:7: request.inputs[0].headers.Authorization: environment variable TOKEN is not set"}, problems)
+}
+
+// TestLoadConfigInterpolation tests that loadConfig expands references in the
+// file and reads MCALL_* variables for every config key
+func TestLoadConfigInterpolation(t *testing.T) {
+	dir := t.TempDir()
+	secret := filepath.Join(dir, "password")
+	assert.NoError(t, os.WriteFile(secret, []byte("hunter2\n"), 0600))
+
+	path := filepath.Join(dir, "mcall.yaml")
+	assert.NoError(t, os.WriteFile(path, []byte(`request:
+    timeout: ${CHECK_TIMEOUT:-7}
+    inputs:
+        - input: ${API_URL}/health
+          type: get
+          headers:
+              X-Token: ${API_TOKEN:-anonymous}
+response:
+    es:
+        password: ${file:`+secret+`}
+`), 0644))
+
+	t.Setenv("API_URL", "http://api.local")
+	t.Setenv("MCALL_WORKER_NUMBER", "4")
+	t.Setenv("MCALL_RESPONSE_ES_HOST", "es.local")
+	t.Setenv("MCALL_REQUEST_RETRYON", "timeout,5xx")
+
+	config, err := loadConfig(path)
+	assert.NoError(t, err)
+	assert.Equal(t, 7, config.Request.Timeout)
+	assert.Equal(t, "http://api.local/health", config.Request.Inputs[0].Input)
+	assert.Equal(t, map[string]string{"X-Token": "anonymous"}, config.Request.Inputs[0].Headers)
+	assert.Equal(t, "hunter2", config.Response.ES.Password)
+	assert.Equal(t, 4, config.Worker.Number)
+	assert.Equal(t, "es.local", config.Response.ES.Host)
+	assert.Equal(t, []string{"timeout", "5xx"}, config.Request.RetryOn)
+
+	// The environment wins over the file
+	t.Setenv("MCALL_REQUEST_TIMEOUT", "9")
+	config, err = loadConfig(path)
+	assert.NoError(t, err)
+	assert.Equal(t, 9, config.Request.Timeout)
+
+	// A missing variable without a default is an error naming the key and line
+	assert.NoError(t, os.WriteFile(path, []byte("log:\n    file: ${LOG_DIR}/mcall.log\n"), 0644))
+	_, err = loadConfig(path)
+	assert.EqualError(t, err, "failed to read config file: invalid configuration:\n  "+path+":2: log.file: environment variable LOG_DIR is not set")
+	diagnostics := validateConfigFile(path)
+	assert.Len(t, diagnostics, 1)
+	assert.Equal(t, path+":2: log.file: environment variable LOG_DIR is not set", diagnostics[0].String())
+}
+
+// TestConfigEnvName tests the environment variable names of config keys
+func TestConfigEnvName(t *testing.T) {
+	assert.Equal(t, "MCALL_REQUEST_TIMEOUT", configEnvName("request.timeout"))
+	assert.Equal(t, "MCALL_RESPONSE_ES_INDEX_NAME", configEnvName("response.es.index_name"))
+	assert.Equal(t, "MCALL_EXIT_FAILON", configEnvName("exit.failOn"))
+}
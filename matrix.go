@@ -0,0 +1,265 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"text/template"
+	"text/template/parse"
+
+	"github.com/mitchellh/mapstructure"
+)
+
+// matrixAxis is one matrix key and the values an input is expanded for
+type matrixAxis struct {
+	Key    string
+	Values []string
+}
+
+// parseMatrix reads a matrix block: a map of keys to a list of values, or a
+// single value. Axes are sorted by key so expansion order is stable.
+func parseMatrix(value interface{}) ([]matrixAxis, error) {
+	if value == nil {
+		return nil, nil
+	}
+	matrix, ok := value.(map[string]interface{})
+	if !ok {
+		return nil, fmt.Errorf("matrix must be a map of value lists")
+	}
+
+	axes := make([]matrixAxis, 0, len(matrix))
+	for key, values := range matrix {
+		axis := matrixAxis{Key: key}
+		switch v := values.(type) {
+		case []interface{}:
+			for _, item := range v {
+				switch item.(type) {
+				case string, bool, int, float64:
+					axis.Values = append(axis.Values, fmt.Sprint(item))
+				default:
+					return nil, fmt.Errorf("matrix.%s values must be plain values", key)
+				}
+			}
+		case []string:
+			axis.Values = v
+		case string, bool, int, float64:
+			axis.Values = []string{fmt.Sprint(v)}
+		default:
+			return nil, fmt.Errorf("matrix.%s must be a list of values", key)
+		}
+		if len(axis.Values) == 0 {
+			return nil, fmt.Errorf("matrix.%s must not be empty", key)
+		}
+		axes = append(axes, axis)
+	}
+	sort.Slice(axes, func(i, j int) bool { return axes[i].Key < axes[j].Key })
+	return axes, nil
+}
+
+// matrixCombinations lists every combination of axis values, one value per
+// axis in axis order, varying the last axis fastest
+func matrixCombinations(axes []matrixAxis) [][]string {
+	combinations := [][]string{nil}
+	for _, axis := range axes {
+		next := make([][]string, 0, len(combinations)*len(axis.Values))
+		for _, combination := range combinations {
+			for _, value := range axis.Values {
+				next = append(next, append(append([]string(nil), combination...), value))
+			}
+		}
+		combinations = next
+	}
+	return combinations
+}
+
+// expandInputItem renders the Go templates in an input item once for every
+// combination of its matrix values, with vars available to every template.
+// Matrix inputs without a templated name are named after their base name and
+// values, like redis-prod-6379. Without a matrix only the strings that use
+// one of vars are rendered, so inputs that contain {{ }} for other tools keep
+// working whatever --set values are given.
+func expandInputItem(item map[string]interface{}, vars map[string]string) ([]map[string]interface{}, error) {
+	axes, err := parseMatrix(item["matrix"])
+	if err != nil {
+		return nil, err
+	}
+	if len(axes) == 0 && len(vars) == 0 {
+		return []map[string]interface{}{item}, nil
+	}
+
+	base := make(map[string]interface{}, len(item))
+	for key, value := range item {
+		if key != "matrix" {
+			base[key] = value
+		}
+	}
+	name, _ := base["name"].(string)
+
+	combinations := matrixCombinations(axes)
+	items := make([]map[string]interface{}, 0, len(combinations))
+	for _, values := range combinations {
+		data := make(map[string]string, len(vars)+len(axes))
+		for key, value := range vars {
+			data[key] = value
+		}
+		for i, axis := range axes {
+			data[axis.Key] = values[i]
+		}
+
+		rendered, err := renderValue("", base, data, len(axes) > 0)
+		if err != nil {
+			return nil, err
+		}
+		expanded := rendered.(map[string]interface{})
+		if len(axes) > 0 && !strings.Contains(name, "{{") {
+			parts := values
+			if name != "" {
+				parts = append([]string{name}, values...)
+			}
+			expanded["name"] = strings.Join(parts, "-")
+		}
+		items = append(items, expanded)
+	}
+	return items, nil
+}
+
+// renderValue executes the templates in the strings of a decoded value: all
+// of them, or only those that use a key of data; path names the field in
+// errors
+func renderValue(path string, value interface{}, data map[string]string, all bool) (interface{}, error) {
+	child := func(key string) string {
+		if path == "" {
+			return key
+		}
+		return path + "." + key
+	}
+
+	switch v := value.(type) {
+	case string:
+		if !strings.Contains(v, "{{") {
+			return v, nil
+		}
+		tmpl, err := template.New(path).Option("missingkey=error").Parse(v)
+		if !all && (err != nil || !usesKeys(tmpl.Tree.Root, data)) {
+			return v, nil
+		}
+		if err != nil {
+			return nil, fmt.Errorf("%s", strings.TrimPrefix(err.Error(), "template: "))
+		}
+		var out strings.Builder
+		if err := tmpl.Execute(&out, data); err != nil {
+			return nil, fmt.Errorf("%s", strings.TrimPrefix(err.Error(), "template: "))
+		}
+		return out.String(), nil
+	case map[string]interface{}:
+		rendered := make(map[string]interface{}, len(v))
+		for key, item := range v {
+			r, err := renderValue(child(key), item, data, all)
+			if err != nil {
+				return nil, err
+			}
+			rendered[key] = r
+		}
+		return rendered, nil
+	case map[string]string:
+		rendered := make(map[string]string, len(v))
+		for key, item := range v {
+			r, err := renderValue(child(key), item, data, all)
+			if err != nil {
+				return nil, err
+			}
+			rendered[key] = r.(string)
+		}
+		return rendered, nil
+	case []interface{}:
+		rendered := make([]interface{}, len(v))
+		for i, item := range v {
+			r, err := renderValue(path, item, data, all)
+			if err != nil {
+				return nil, err
+			}
+			rendered[i] = r
+		}
+		return rendered, nil
+	case []string:
+		rendered := make([]string, len(v))
+		for i, item := range v {
+			r, err := renderValue(path, item, data, all)
+			if err != nil {
+				return nil, err
+			}
+			rendered[i] = r.(string)
+		}
+		return rendered, nil
+	default:
+		return value, nil
+	}
+}
+
+// usesKeys reports whether a template node refers to one of the keys of data
+// as a field of the dot, like {{.host}}
+func usesKeys(node parse.Node, data map[string]string) bool {
+	switch n := node.(type) {
+	case *parse.ListNode:
+		if n == nil {
+			return false
+		}
+		for _, child := range n.Nodes {
+			if usesKeys(child, data) {
+				return true
+			}
+		}
+	case *parse.ActionNode:
+		return usesKeys(n.Pipe, data)
+	case *parse.PipeNode:
+		if n == nil {
+			return false
+		}
+		for _, cmd := range n.Cmds {
+			if usesKeys(cmd, data) {
+				return true
+			}
+		}
+	case *parse.CommandNode:
+		for _, arg := range n.Args {
+			if usesKeys(arg, data) {
+				return true
+			}
+		}
+	case *parse.FieldNode:
+		_, ok := data[n.Ident[0]]
+		return ok
+	case *parse.ChainNode:
+		return usesKeys(n.Node, data)
+	case *parse.IfNode:
+		return usesKeys(n.Pipe, data) || usesKeys(n.List, data) || usesKeys(n.ElseList, data)
+	case *parse.RangeNode:
+		return usesKeys(n.Pipe, data) || usesKeys(n.List, data) || usesKeys(n.ElseList, data)
+	case *parse.WithNode:
+		return usesKeys(n.Pipe, data) || usesKeys(n.List, data) || usesKeys(n.ElseList, data)
+	}
+	return false
+}
+
+// expandInputConfig expands the matrix and templates of a decoded input config
+func expandInputConfig(cfg InputConfig, vars map[string]string) ([]InputConfig, error) {
+	if len(cfg.Matrix) == 0 && len(vars) == 0 {
+		return []InputConfig{cfg}, nil
+	}
+
+	item := map[string]interface{}{}
+	if err := mapstructure.Decode(cfg, &item); err != nil {
+		return nil, err
+	}
+	items, err := expandInputItem(item, vars)
+	if err != nil {
+		return nil, err
+	}
+	configs := make([]InputConfig, len(items))
+	for i, expanded := range items {
+		if configs[i], err = decodeInputConfig(expanded); err != nil {
+			return nil, err
+		}
+	}
+	return configs, nil
+}
@@ -0,0 +1,110 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/op/go-logging"
+	"github.com/stretchr/testify/assert"
+)
+
+// TestExpandInputItem tests matrix expansion, generated names and vars
+func TestExpandInputItem(t *testing.T) {
+	item := map[string]interface{}{
+		"name":    "redis",
+		"input":   "redis-{{.env}}.{{.domain}}:{{.port}}",
+		"type":    "tcp",
+		"headers": map[string]interface{}{"X-Env": "{{.env}}"},
+		"matrix":  map[string]interface{}{"env": []interface{}{"dev", "prod"}, "port": []interface{}{6379, 6380.0}},
+	}
+	items, err := expandInputItem(item, map[string]string{"domain": "example.com", "env": "ignored"})
+	assert.NoError(t, err)
+
+	var names, inputs []string
+	for _, expanded := range items {
+		names = append(names, expanded["name"].(string))
+		inputs = append(inputs, expanded["input"].(string))
+		assert.NotContains(t, expanded, "matrix")
+	}
+	assert.Equal(t, []string{"redis-dev-6379", "redis-dev-6380", "redis-prod-6379", "redis-prod-6380"}, names)
+	assert.Equal(t, "redis-dev.example.com:6379", inputs[0], "matrix values win over vars")
+	assert.Equal(t, "redis-prod.example.com:6380", inputs[3])
+	assert.Equal(t, "prod", items[3]["headers"].(map[string]interface{})["X-Env"])
+	assert.Equal(t, "{{.env}}", item["headers"].(map[string]interface{})["X-Env"], "the item itself is not changed")
+
+	// A templated name is rendered instead of generated
+	items, err = expandInputItem(map[string]interface{}{
+		"name": "{{.env}}-api", "input": "http://{{.env}}.example.com/", "matrix": map[string]interface{}{"env": "stg"},
+	}, nil)
+	assert.NoError(t, err)
+	assert.Equal(t, "stg-api", items[0]["name"])
+
+	// Without a matrix templates meant for other tools are left alone, while
+	// strings that use a var are rendered
+	docker := map[string]interface{}{"input": "docker inspect -f '{{.State.Status}}' web"}
+	items, err = expandInputItem(docker, nil)
+	assert.NoError(t, err)
+	assert.Equal(t, []map[string]interface{}{docker}, items)
+	items, err = expandInputItem(map[string]interface{}{
+		"name":   "{{.container}}-status",
+		"input":  "docker inspect -f '{{.State.Status}}' web",
+		"expect": "{{ if .strict }}running{{ end }}",
+	}, map[string]string{"container": "web", "strict": "yes"})
+	assert.NoError(t, err)
+	assert.Equal(t, []map[string]interface{}{{
+		"name":   "web-status",
+		"input":  "docker inspect -f '{{.State.Status}}' web",
+		"expect": "running",
+	}}, items)
+
+	_, err = expandInputItem(map[string]interface{}{"input": "echo {{.env}}{{.missing}}"}, map[string]string{"env": "dev"})
+	assert.EqualError(t, err, `input:1:15: executing "input" at <.missing>: map has no entry for key "missing"`)
+	_, err = expandInputItem(map[string]interface{}{"input": "pwd", "matrix": map[string]interface{}{"env": []interface{}{}}}, nil)
+	assert.EqualError(t, err, "matrix.env must not be empty")
+	_, err = expandInputItem(map[string]interface{}{"input": "pwd", "matrix": []interface{}{"dev"}}, nil)
+	assert.EqualError(t, err, "matrix must be a map of value lists")
+}
+
+// TestConfigInputsMatrix tests that config inputs expand into checks and that
+// validation checks every expansion
+func TestConfigInputsMatrix(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "mcall.yaml")
+	assert.NoError(t, os.WriteFile(path, []byte(`request:
+    inputs:
+        - input: "{{.scheme}}://api-{{.env}}.example.com/health"
+          type: get
+          name: api
+          labels:
+              env: "{{.env}}"
+          matrix:
+              env: [dev, stg]
+        - input: "echo {{.region}}-{{.zone}}"
+        - input: "docker inspect -f '{{.State.Status}}' web"
+`), 0644))
+
+	_, err := loadSettings([]string{path}, Args{"set": []string{"scheme=https", "region=eu"}})
+	assert.EqualError(t, err, "invalid configuration:\n  "+path+`:10: request.inputs #2 (echo {{.region}}-{{.zone}}): input:1:19: executing "input" at <.zone>: map has no entry for key "zone"`)
+
+	_, err = loadSettings([]string{path}, Args{"set": []string{"scheme=ftp", "region=eu"}})
+	assert.ErrorContains(t, err, `api-dev: invalid URL "ftp://api-dev.example.com/health": scheme must be http or https`)
+
+	args := Args{"set": []string{"scheme=https", "region=eu", "zone=a"}}
+	config, err := loadSettings([]string{path}, args)
+	assert.NoError(t, err)
+	app := NewApp(config)
+	app.logger = logging.MustGetLogger("mcall")
+	app.vars, err = templateVars(args)
+	assert.NoError(t, err)
+
+	checks := app.configInputs()
+	assert.Len(t, checks, 4)
+	assert.Equal(t, "api-dev", checks[0].Name)
+	assert.Equal(t, "https://api-dev.example.com/health", checks[0].Input)
+	assert.Equal(t, "stg", checks[1].Labels["env"])
+	assert.Equal(t, "echo eu-a", checks[2].Input)
+	assert.Equal(t, "docker inspect -f '{{.State.Status}}' web", checks[3].Input, "inputs without a var are not rendered")
+
+	_, err = templateVars(Args{"set": []string{"region"}})
+	assert.EqualError(t, err, `invalid --set "region": want key=value`)
+}
@@ -1,19 +1,25 @@
 package main
 
 import (
+	"bufio"
 	"bytes"
 	"context"
+	"crypto/tls"
+	"crypto/x509"
 	"encoding/base64"
 	"encoding/json"
 	"errors"
-	"flag"
 	"fmt"
 	"io"
+	"math/rand"
+	"net"
 	"net/http"
+	"net/url"
 	"os"
 	"os/exec"
 	"os/signal"
 	"path/filepath"
+	"reflect"
 	"runtime"
 	"strconv"
 	"strings"
@@ -22,6 +28,7 @@ import (
 	"time"
 
 	"github.com/gorilla/pat"
+	"github.com/mitchellh/mapstructure"
 	"github.com/op/go-logging"
 	"github.com/spf13/viper"
 	v1 "k8s.io/api/core/v1"
@@ -42,27 +49,229 @@ const (
 	DefaultLogLevel        = "DEBUG"
 	DefaultLogFile         = "/var/log/mcall/mcall.log"
 	DefaultChannelSize     = 100
+	DefaultResultOrder     = ResultOrderInput
+	DefaultShell           = "/bin/sh"
 	DefaultTimeoutDuration = DefaultTimeout * time.Second
+	DefaultRetryDelay      = time.Second
+	DefaultWaitDeadline    = 5 * time.Minute
+	DefaultWaitInterval    = 2 * time.Second
+	MaxRetryDelay          = 30 * time.Second
 
 	LogFormat = "%{color}%{time:15:04:05.000000} %{shortfunc} ▶ %{level:.4s} %{id:03x}%{color:reset} %{message}"
 
 	// Error codes
-	ErrorCodeSuccess = "0"
-	ErrorCodeFailure = "-1"
+	ErrorCodeSuccess     = "0"
+	ErrorCodeFailure     = "-1" // unclassified failure
+	ErrorCodeCommand     = "1"  // command exited non-zero or could not start
+	ErrorCodeHTTP        = "2"  // HTTP request could not be made or completed
+	ErrorCodeExpect      = "3"  // response did not satisfy expect
+	ErrorCodeTimeout     = "4"  // command or request exceeded its timeout
+	ErrorCodeDNS         = "5"  // host name could not be resolved
+	ErrorCodeConnRefused = "6"  // target refused the connection
+	ErrorCodeTLS         = "7"  // TLS handshake or certificate failure
+	ErrorCodeTCP         = "8"  // TCP connection failed for another reason
+	ErrorCodeSkipped     = "9"  // not run because a dependency did not pass
 
 	// Request types
-	RequestTypeCmd  = "cmd"
-	RequestTypeGet  = "get"
-	RequestTypePost = "post"
+	RequestTypeCmd   = "cmd"
+	RequestTypeShell = "sh"
+	RequestTypeGet   = "get"
+	RequestTypePost  = "post"
+	RequestTypeHTTP  = "http"
+	RequestTypeTCP   = "tcp"
 
 	// HTTP methods
-	HTTPMethodGet  = "GET"
-	HTTPMethodPost = "POST"
+	HTTPMethodGet     = "GET"
+	HTTPMethodPost    = "POST"
+	HTTPMethodPut     = "PUT"
+	HTTPMethodPatch   = "PATCH"
+	HTTPMethodDelete  = "DELETE"
+	HTTPMethodHead    = "HEAD"
+	HTTPMethodOptions = "OPTIONS"
 
 	// Content types
 	ContentTypeJSON = "application/json"
+
+	// TCPBannerSize bounds how much of a TCP banner or reply is read
+	TCPBannerSize = 4096
+
+	// Result ordering
+	ResultOrderInput      = "input"
+	ResultOrderCompletion = "completion"
+
+	// Exit policies: which check failures make the process exit non-zero
+	FailOnAny       = "any"
+	FailOnAll       = "all"
+	FailOnThreshold = "threshold"
+
+	// Process exit codes
+	ExitOK          = 0
+	ExitCheckFailed = 1 // checks ran and failed under the exit policy
+	ExitConfigError = 2 // configuration or usage error, checks did not run
+
+	// Retry conditions
+	RetryOnTimeout = "timeout"
+	RetryOnConnect = "connect"
+	RetryOnExpect  = "expect"
+	RetryOn5xx     = "5xx"
 )
 
+// DefaultRetryOn lists the conditions retried when retryOn is not set
+var DefaultRetryOn = []string{RetryOnTimeout, RetryOnConnect, RetryOn5xx}
+
+// ExitPolicy decides whether a run's failed checks fail the process
+type ExitPolicy struct {
+	FailOn    string // any, all or threshold
+	Threshold int    // failed checks (or percent of checks) that fail the run
+	Percent   bool
+}
+
+// parseExitPolicy reads a fail-on mode and a threshold such as "3" or "25%"
+func parseExitPolicy(failOn, threshold string) (ExitPolicy, error) {
+	policy := ExitPolicy{FailOn: strings.ToLower(strings.TrimSpace(failOn))}
+	if policy.FailOn == "" {
+		policy.FailOn = FailOnAny
+	}
+
+	switch policy.FailOn {
+	case FailOnAny, FailOnAll:
+		return policy, nil
+	case FailOnThreshold:
+	default:
+		return policy, fmt.Errorf("unknown fail-on mode %q (any, all, threshold)", failOn)
+	}
+
+	value := strings.TrimSpace(threshold)
+	if strings.HasSuffix(value, "%") {
+		policy.Percent = true
+		value = strings.TrimSuffix(value, "%")
+	}
+	n, err := strconv.Atoi(value)
+	if err != nil || n < 1 || (policy.Percent && n > 100) {
+		return policy, fmt.Errorf("threshold policy needs a count or percentage but got %q", threshold)
+	}
+	policy.Threshold = n
+	return policy, nil
+}
+
+// Fails reports whether failed out of total checks fails the run
+func (p ExitPolicy) Fails(failed, total int) bool {
+	switch p.FailOn {
+	case FailOnAll:
+		return total > 0 && failed == total
+	case FailOnThreshold:
+		if p.Percent {
+			return total > 0 && failed*100 >= p.Threshold*total
+		}
+		return failed >= p.Threshold
+	default:
+		return failed > 0
+	}
+}
+
+// String describes the policy for summaries
+func (p ExitPolicy) String() string {
+	if p.FailOn != FailOnThreshold {
+		return p.FailOn
+	}
+	if p.Percent {
+		return fmt.Sprintf("threshold %d%%", p.Threshold)
+	}
+	return fmt.Sprintf("threshold %d", p.Threshold)
+}
+
+// CheckFailure is returned when checks ran but failed under the exit policy
+type CheckFailure struct {
+	Failed []FetchedResult
+	Total  int
+	Policy ExitPolicy
+}
+
+func (e *CheckFailure) Error() string {
+	failures := make([]string, len(e.Failed))
+	for i, result := range e.Failed {
+		failures[i] = fmt.Sprintf("%s: %s", resultLabel(result), result.ErrorMessage)
+	}
+	return fmt.Sprintf("%d of %d checks failed (fail-on %s): %s", len(e.Failed), e.Total, e.Policy, strings.Join(failures, "; "))
+}
+
+// resultLabel names a result by its name, falling back to its input
+func resultLabel(result FetchedResult) string {
+	if result.Name != "" {
+		return result.Name
+	}
+	return result.Input
+}
+
+// resultLabels lists results by name for summaries
+func resultLabels(results []FetchedResult) string {
+	labels := make([]string, len(results))
+	for i, result := range results {
+		labels[i] = resultLabel(result)
+	}
+	return strings.Join(labels, ", ")
+}
+
+// ErrTimeout is wrapped by fetch errors caused by an expired timeout
+var ErrTimeout = errors.New("timed out")
+
+// FetchError is a fetch failure tagged with the error code reported in results
+type FetchError struct {
+	Code string
+	Err  error
+}
+
+func (e *FetchError) Error() string {
+	return e.Err.Error()
+}
+
+func (e *FetchError) Unwrap() error {
+	return e.Err
+}
+
+// errorCode maps an error onto the stable code reported in results
+func errorCode(err error) string {
+	if err == nil {
+		return ErrorCodeSuccess
+	}
+	var fetchErr *FetchError
+	if errors.As(err, &fetchErr) {
+		return fetchErr.Code
+	}
+	return ErrorCodeFailure
+}
+
+// classifyHTTPError tags an HTTP failure with the most specific error code
+func classifyHTTPError(err error) error {
+	return classifyNetworkError(err, ErrorCodeHTTP)
+}
+
+// classifyNetworkError tags a network failure with the most specific error
+// code, using fallback when no specific cause is recognized
+func classifyNetworkError(err error, fallback string) error {
+	var dnsErr *net.DNSError
+	var unknownAuthErr x509.UnknownAuthorityError
+	var hostnameErr x509.HostnameError
+	var certInvalidErr x509.CertificateInvalidError
+	var recordHeaderErr tls.RecordHeaderError
+
+	code := fallback
+	switch {
+	case errors.Is(err, ErrTimeout):
+		code = ErrorCodeTimeout
+	case errors.As(err, &dnsErr):
+		code = ErrorCodeDNS
+	case errors.Is(err, syscall.ECONNREFUSED):
+		code = ErrorCodeConnRefused
+	case errors.As(err, &unknownAuthErr), errors.As(err, &hostnameErr),
+		errors.As(err, &certInvalidErr), errors.As(err, &recordHeaderErr),
+		strings.Contains(err.Error(), "tls: "):
+		code = ErrorCodeTLS
+	}
+
+	return &FetchError{Code: code, Err: err}
+}
+
 // Config holds all configuration settings
 type Config struct {
 	Worker struct {
@@ -77,6 +286,7 @@ type Config struct {
 
 	Response struct {
 		Format   string `mapstructure:"format"`
+		Order    string `mapstructure:"order"`
 		Encoding struct {
 			Type string `mapstructure:"type"`
 		} `mapstructure:"encoding"`
@@ -89,17 +299,28 @@ type Config struct {
 	} `mapstructure:"response"`
 
 	Request struct {
-		Subject string `mapstructure:"subject"`
-		Timeout int    `mapstructure:"timeout"`
-		Input   string `mapstructure:"input"`
-		Type    string `mapstructure:"type"`
-		Name    string `mapstructure:"name"`
+		Subject string        `mapstructure:"subject"`
+		Timeout int           `mapstructure:"timeout"`
+		Input   string        `mapstructure:"input"`  // legacy {"inputs": [...]} JSON
+		Inputs  []InputConfig `mapstructure:"inputs"` // checks as a YAML list
+		Type    string        `mapstructure:"type"`
+		Name    string        `mapstructure:"name"`
+		Shell   string        `mapstructure:"shell"`
+
+		Retries    int      `mapstructure:"retries"`
+		RetryDelay string   `mapstructure:"retryDelay"`
+		RetryOn    []string `mapstructure:"retryOn"`
 	} `mapstructure:"request"`
 
 	Log struct {
 		Level string `mapstructure:"level"`
 		File  string `mapstructure:"file"`
 	} `mapstructure:"log"`
+
+	Exit struct {
+		FailOn    string `mapstructure:"failOn"`
+		Threshold string `mapstructure:"threshold"`
+	} `mapstructure:"exit"`
 }
 
 // App represents the main application
@@ -110,12 +331,19 @@ type App struct {
 	timeout        int
 	subject        string
 	format         string
+	order          string
 	base64         string
+	shell          string
+	retry          RetryPolicy
+	exitPolicy     ExitPolicy
 	esConfig       ESConfig
 	clientset      *kubernetes.Clientset
 	leaderElection bool
 	namespace      string
 	lockName       string
+	selector       Selector          // checks the agent distributes
+	vars           map[string]string // --set template variables
+	live           *liveConfig       // set when the config is reloadable
 }
 
 // ESConfig holds Elasticsearch configuration
@@ -128,39 +356,247 @@ type ESConfig struct {
 
 // FetchedResult represents the result of a fetch operation
 type FetchedResult struct {
-	Input   string `json:"input"`
-	Name    string `json:"name"`
-	Error   string `json:"errorCode"`
-	Content string `json:"result"`
-	TS      string `json:"ts"`
+	Input        string            `json:"input"`
+	Name         string            `json:"name"`
+	Type         string            `json:"type"`
+	Error        string            `json:"errorCode"`
+	ErrorMessage string            `json:"error,omitempty"`
+	Content      string            `json:"result"`
+	TS           string            `json:"ts"`
+	Timeout      time.Duration     `json:"timeout"`
+	TimedOut     bool              `json:"timedOut"`
+	Duration     time.Duration     `json:"duration"`
+	ExitCode     int               `json:"exitCode"`
+	Stdout       string            `json:"stdout,omitempty"`
+	Stderr       string            `json:"stderr,omitempty"`
+	StatusCode   int               `json:"statusCode,omitempty"`
+	Headers      http.Header       `json:"headers,omitempty"`
+	URL          string            `json:"url,omitempty"`
+	Connect      time.Duration     `json:"connect,omitempty"`
+	Negated      bool              `json:"negated,omitempty"`
+	Attempts     int               `json:"attempts,omitempty"`
+	AttemptErrs  []string          `json:"attemptErrors,omitempty"`
+	Tags         []string          `json:"tags,omitempty"`
+	Labels       map[string]string `json:"labels,omitempty"`
+	Skipped      bool              `json:"skipped,omitempty"`
+}
+
+// InputConfig is one input as written in request.inputs, the request.input
+// JSON, web parameters, command line input items or leader election tasks.
+// Fields that accept more than one form are left for inputOptions.
+type InputConfig struct {
+	Input        string                 `mapstructure:"input"`
+	Type         string                 `mapstructure:"type"`
+	Name         string                 `mapstructure:"name"`
+	Expect       string                 `mapstructure:"expect"`
+	Timeout      interface{}            `mapstructure:"timeout"` // seconds or a duration
+	Shell        interface{}            `mapstructure:"shell"`   // true or an interpreter path
+	Method       string                 `mapstructure:"method"`
+	Headers      map[string]string      `mapstructure:"headers"`
+	Body         interface{}            `mapstructure:"body"`  // structured bodies are sent as JSON
+	Query        map[string]interface{} `mapstructure:"query"` // values may be lists
+	ContentType  string                 `mapstructure:"contentType"`
+	Send         string                 `mapstructure:"send"`
+	Read         bool                   `mapstructure:"read"`
+	Blocked      bool                   `mapstructure:"blocked"`
+	ExpectFail   bool                   `mapstructure:"expectFail"`
+	Negate       bool                   `mapstructure:"negate"`       // alias of expectFail
+	ExpectStatus interface{}            `mapstructure:"expectStatus"` // code, list or "2xx,301"
+	MaxLatency   interface{}            `mapstructure:"maxLatency"`   // milliseconds or a duration
+	Retries      *int                   `mapstructure:"retries"`
+	RetryDelay   interface{}            `mapstructure:"retryDelay"`
+	RetryOn      interface{}            `mapstructure:"retryOn"` // list or comma separated
+	Until        interface{}            `mapstructure:"until"`   // true or a deadline
+	Interval     interface{}            `mapstructure:"interval"`
+	Tags         interface{}            `mapstructure:"tags"` // list or comma separated
+	Labels       map[string]string      `mapstructure:"labels"`
+	Matrix       map[string]interface{} `mapstructure:"matrix"`    // expanded by expandInputConfig
+	DependsOn    interface{}            `mapstructure:"dependsOn"` // names, list or comma separated
+}
+
+// decodeInputConfig decodes an input item map into an InputConfig, converting
+// scalars the way viper does for request.inputs
+func decodeInputConfig(item map[string]interface{}) (InputConfig, error) {
+	var cfg InputConfig
+	decoder, err := mapstructure.NewDecoder(&mapstructure.DecoderConfig{
+		WeaklyTypedInput: true,
+		Result:           &cfg,
+	})
+	if err != nil {
+		return cfg, err
+	}
+	return cfg, decoder.Decode(item)
+}
+
+// InputOptions holds the per-input settings parsed from an InputConfig
+type InputOptions struct {
+	Timeout    time.Duration
+	Shell      string
+	HTTP       HTTPRequest
+	TCP        TCPRequest
+	ExpectFail bool
+
+	ExpectProgram *ExpectProgram // expect compiled while parsing, nil when empty or invalid
+
+	ExpectStatus StatusRanges  // accepted HTTP status codes
+	MaxLatency   time.Duration // slowest acceptable response
+	Retry        *RetryPolicy  // nil uses the global policy
+	Until        time.Duration // poll until the checks pass or this deadline expires
+	Interval     time.Duration // wait between polls
+
+	Tags   []string          // selection tags
+	Labels map[string]string // selection labels, also carried into results
+
+	DependsOn []string // names of the checks that must pass first
+}
+
+// Check is one input to execute with everything needed to run and report
+// it. Parsing produces one Check per input, so per-input fields always stay
+// together.
+type Check struct {
+	Input  string
+	Type   string
+	Name   string
+	Expect string
+	InputOptions
+}
+
+// compiledExpect returns the expect compiled while parsing, compiling it for
+// checks that were built directly or whose expect is invalid
+func (c Check) compiledExpect() (*ExpectProgram, error) {
+	if c.ExpectProgram != nil {
+		return c.ExpectProgram, nil
+	}
+	return compileExpect(c.Expect)
+}
+
+// RetryPolicy controls how often a failed input is attempted again
+type RetryPolicy struct {
+	Retries int           // extra attempts after the first
+	Delay   time.Duration // wait before the first retry, doubled for each one after
+	On      []string      // conditions that are retried (timeout, connect, expect, 5xx)
+}
+
+// delay returns the backoff before the given retry (1-based): the base delay
+// doubled per retry, capped at MaxRetryDelay, with jitter in [d/2, d)
+func (rp RetryPolicy) delay(retry int) time.Duration {
+	d := rp.Delay
+	if d <= 0 {
+		d = DefaultRetryDelay
+	}
+	for i := 1; i < retry && d < MaxRetryDelay; i++ {
+		d *= 2
+	}
+	if d > MaxRetryDelay {
+		d = MaxRetryDelay
+	}
+	half := d / 2
+	return half + time.Duration(rand.Int63n(int64(d-half)+1))
+}
+
+// shouldRetry reports whether a failed attempt matches one of the retry conditions
+func (rp RetryPolicy) shouldRetry(doc ResultDoc, err error) bool {
+	on := rp.On
+	if len(on) == 0 {
+		on = DefaultRetryOn
+	}
+
+	code := errorCode(err)
+	for _, condition := range on {
+		switch condition {
+		case RetryOnTimeout:
+			if code == ErrorCodeTimeout {
+				return true
+			}
+		case RetryOnConnect:
+			switch code {
+			case ErrorCodeHTTP, ErrorCodeDNS, ErrorCodeConnRefused, ErrorCodeTLS, ErrorCodeTCP:
+				return true
+			}
+		case RetryOnExpect:
+			if code == ErrorCodeExpect {
+				return true
+			}
+		case RetryOn5xx:
+			// Without expectStatus a 5xx response is not an error, so check it first
+			if doc.StatusCode >= 500 && doc.StatusCode <= 599 {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// StatusRange is an inclusive range of HTTP status codes
+type StatusRange struct {
+	Min, Max int
+}
+
+// StatusRanges is a list of accepted status codes, such as 2xx,301,302
+type StatusRanges []StatusRange
+
+// Match reports whether status falls in any of the ranges
+func (sr StatusRanges) Match(status int) bool {
+	for _, r := range sr {
+		if status >= r.Min && status <= r.Max {
+			return true
+		}
+	}
+	return false
 }
 
-// FetchedInput tracks processed inputs to avoid duplicates
-type FetchedInput struct {
-	m map[string]error
-	sync.RWMutex
+// Redirects reports whether any of the ranges accepts a 3xx status
+func (sr StatusRanges) Redirects() bool {
+	for _, r := range sr {
+		if r.Min <= 399 && r.Max >= 300 {
+			return true
+		}
+	}
+	return false
 }
 
-// NewFetchedInput creates a new FetchedInput instance
-func NewFetchedInput() *FetchedInput {
-	return &FetchedInput{
-		m: make(map[string]error),
+// String formats the ranges the way parseExpectStatus reads them
+func (sr StatusRanges) String() string {
+	parts := make([]string, len(sr))
+	for i, r := range sr {
+		switch {
+		case r.Min == r.Max:
+			parts[i] = strconv.Itoa(r.Min)
+		case r.Min%100 == 0 && r.Max == r.Min+99:
+			parts[i] = fmt.Sprintf("%dxx", r.Min/100)
+		default:
+			parts[i] = fmt.Sprintf("%d-%d", r.Min, r.Max)
+		}
 	}
+	return strings.Join(parts, ",")
 }
 
-// IsProcessed checks if an input has already been processed
-func (fi *FetchedInput) IsProcessed(input string) bool {
-	fi.RLock()
-	defer fi.RUnlock()
-	_, exists := fi.m[input]
-	return exists
+// TCPRequest describes the probe sent for a tcp input
+type TCPRequest struct {
+	Send    string // payload written after connecting
+	Read    bool   // read a banner or reply after connecting
+	Blocked bool   // succeed only when the connection is refused or times out
 }
 
-// MarkProcessed marks an input as processed
-func (fi *FetchedInput) MarkProcessed(input string, err error) {
-	fi.Lock()
-	defer fi.Unlock()
-	fi.m[input] = err
+// HTTPRequest describes the HTTP request sent for an input
+type HTTPRequest struct {
+	Method      string
+	Headers     map[string]string
+	Body        string
+	Query       url.Values
+	ContentType string
+	NoRedirect  bool // report 3xx responses instead of following them
+}
+
+// httpMethods lists the methods accepted in an input's method field
+var httpMethods = map[string]bool{
+	HTTPMethodGet:     true,
+	HTTPMethodPost:    true,
+	HTTPMethodPut:     true,
+	HTTPMethodPatch:   true,
+	HTTPMethodDelete:  true,
+	HTTPMethodHead:    true,
+	HTTPMethodOptions: true,
 }
 
 // Commander interface for executing commands
@@ -170,168 +606,240 @@ type Commander interface {
 
 // CallFetch represents a fetch operation
 type CallFetch struct {
-	fetchedInput *FetchedInput
 	pipeline     *Pipeline
 	input        string
 	sType        string
 	name         string
 	expect       string
+	program      *ExpectProgram // expect compiled, nil when empty or invalid
+	programErr   error          // why expect did not compile
+	timeout      time.Duration
+	shell        string
+	request      HTTPRequest
+	tcp          TCPRequest
+	expectFail   bool
+	expectStatus StatusRanges
+	maxLatency   time.Duration
+	retry        RetryPolicy
+	until        time.Duration
+	interval     time.Duration
+	tags         []string
+	labels       map[string]string
 	result       chan FetchedResult
 }
 
 // NewCallFetch creates a new CallFetch instance
-func NewCallFetch(fetchedInput *FetchedInput, pipeline *Pipeline, input, sType, name, expect string) *CallFetch {
-	return &CallFetch{
-		fetchedInput: fetchedInput,
-		pipeline:     pipeline,
-		input:        input,
-		sType:        sType,
-		name:         name,
-		expect:       expect,
-		result:       make(chan FetchedResult, 1),
-	}
+func NewCallFetch(pipeline *Pipeline, input, sType, name, expect string) *CallFetch {
+	cf := &CallFetch{
+		pipeline: pipeline,
+		input:    input,
+		sType:    sType,
+		name:     name,
+		expect:   expect,
+		timeout:  DefaultTimeoutDuration,
+		result:   make(chan FetchedResult, 1),
+	}
+	cf.program, cf.programErr = compileExpect(expect)
+	return cf
 }
 
 // Execute implements the Commander interface
 func (cf *CallFetch) Execute() error {
-	if cf.fetchedInput.IsProcessed(cf.input) {
-		return nil
+	var doc ResultDoc
+	var duration time.Duration
+	var err error
+	var attemptErrs []string
+
+	attempts := 0
+	if cf.until > 0 {
+		doc, duration, attempts, err = cf.poll()
+	} else {
+		for {
+			attempts++
+			doc, duration, err = cf.attempt()
+			if attempts > cf.retry.Retries || !cf.retry.shouldRetry(doc, err) {
+				break
+			}
+			attemptErrs = append(attemptErrs, attemptError(doc, err))
+			time.Sleep(cf.retry.delay(attempts))
+		}
+		if err != nil && len(attemptErrs) > 0 {
+			attemptErrs = append(attemptErrs, err.Error())
+		}
+	}
+
+	doc.Raw = cf.parseContent(doc.Raw)
+	result := cf.newResult(doc, duration, err)
+	// Block-access tcp checks invert their result just like expectFail
+	result.Negated = cf.expectFail || (cf.sType == RequestTypeTCP && cf.tcp.Blocked)
+	if cf.retry.Retries > 0 || cf.until > 0 {
+		result.Attempts = attempts
+		result.AttemptErrs = attemptErrs
 	}
+	cf.result <- result
+	return err
+}
 
-	var doc string
+// attemptError describes a retried attempt: its error, or the 5xx status
+// that was retried without one
+func attemptError(doc ResultDoc, err error) string {
+	if err != nil {
+		return err.Error()
+	}
+	return fmt.Sprintf("status %d", doc.StatusCode)
+}
+
+// poll re-executes the input every interval until it passes or the until
+// deadline expires, returning the last failure wrapped with how long it waited
+func (cf *CallFetch) poll() (ResultDoc, time.Duration, int, error) {
+	interval := cf.interval
+	if interval <= 0 {
+		interval = DefaultWaitInterval
+	}
+	deadline := time.Now().Add(cf.until)
+
+	for attempts := 1; ; attempts++ {
+		doc, duration, err := cf.attempt()
+		if err == nil {
+			return doc, duration, attempts, nil
+		}
+		if time.Now().Add(interval).After(deadline) {
+			return doc, duration, attempts, &FetchError{
+				Code: errorCode(err),
+				Err:  fmt.Errorf("gave up waiting after %v and %d attempts: %w", cf.until, attempts, err),
+			}
+		}
+		time.Sleep(interval)
+	}
+}
+
+// attempt fetches the input once and applies status, expect and negation checks
+func (cf *CallFetch) attempt() (ResultDoc, time.Duration, error) {
+	var doc ResultDoc
 	var err error
 
+	start := time.Now()
 	if cf.input != "" {
 		switch cf.sType {
-		case RequestTypeCmd:
-			doc, err = fetchCmd(cf.input)
-		case RequestTypeGet:
-			doc, err = fetchHTTP(cf.input, HTTPMethodGet, nil)
-		case RequestTypePost:
-			// For POST requests, we might need to extract data from the URL
-			// This is a simplified implementation - you might want to enhance it
-			doc, err = fetchHTTP(cf.input, HTTPMethodPost, nil)
+		case RequestTypeCmd, RequestTypeShell:
+			doc, err = fetchCmd(cf.input, cf.shell, cf.timeout)
+		case RequestTypeTCP:
+			doc, err = fetchTCP(cf.input, cf.tcp, cf.timeout)
+			if cf.tcp.Blocked {
+				doc, err = checkBlocked(cf.input, doc, err)
+			}
 		default:
-			// Default to GET for unknown types
-			doc, err = fetchHTTP(cf.input, HTTPMethodGet, nil)
+			// get, post, http and method-named types are all HTTP requests
+			if !validRequestType(cf.sType) {
+				err = &FetchError{Code: ErrorCodeFailure, Err: fmt.Errorf("unknown type %q", cf.sType)}
+				break
+			}
+			doc, err = fetchHTTP(cf.input, cf.httpRequest(), cf.timeout)
 		}
 	}
+	duration := time.Since(start)
+
+	if err == nil {
+		err = cf.checkStatus(doc, duration)
+	}
 
 	// Check expect validation if specified
 	if cf.expect != "" && err == nil {
-		if validationErr := cf.checkExpect(doc); validationErr != nil {
+		if validationErr := cf.checkExpect(doc, duration); validationErr != nil {
 			err = validationErr
 		}
 	}
 
-	cf.fetchedInput.MarkProcessed(cf.input, err)
+	if cf.expectFail {
+		doc, err = invertResult(cf.input, doc, err)
+	}
+	return doc, duration, err
+}
 
-	content := cf.parseContent(doc)
-	var errCode string
+// invertResult applies a negative assertion: any failure (connection error,
+// timeout, failed command or unmatched expect) becomes success, and success
+// becomes an expect failure
+func invertResult(input string, doc ResultDoc, err error) (ResultDoc, error) {
 	if err != nil {
-		errCode = ErrorCodeFailure
-	} else {
-		errCode = ErrorCodeSuccess
+		if doc.Raw == "" {
+			doc.Raw = fmt.Sprintf("expected failure: %v", err)
+		}
+		return doc, nil
 	}
+	return doc, &FetchError{Code: ErrorCodeExpect, Err: fmt.Errorf("expected %s to fail but it succeeded", input)}
+}
 
-	now := time.Now().UTC()
-	result := FetchedResult{
-		Input:   cf.input,
-		Name:    cf.name,
-		Error:   errCode,
-		Content: content,
-		TS:      now.Format("2006-01-02T15:04:05.000"),
+// httpRequest resolves the HTTP request for this fetch. An explicit method
+// wins, then a method-named type (get, post, put, ...), falling back to GET.
+func (cf *CallFetch) httpRequest() HTTPRequest {
+	req := cf.request
+	if req.Method == "" {
+		req.Method = HTTPMethodGet
+		if method := strings.ToUpper(cf.sType); httpMethods[method] {
+			req.Method = method
+		}
 	}
-
-	cf.result <- result
-	return err
+	// A check that expects a redirect must see it rather than its target
+	req.NoRedirect = cf.expectStatus.Redirects()
+	return req
 }
 
-// checkExpect validates the response against expected patterns
-func (cf *CallFetch) checkExpect(response string) error {
-	if cf.expect == "" {
-		return nil
+// newResult builds the FetchedResult reported for this fetch
+func (cf *CallFetch) newResult(doc ResultDoc, duration time.Duration, err error) FetchedResult {
+	errCode := errorCode(err)
+	var errMsg string
+	if err != nil {
+		errMsg = err.Error()
 	}
 
-	expectArray := strings.Split(cf.expect, "|")
-	matched := false
-	var lastErr error
-
-	for _, expectPattern := range expectArray {
-		expectPattern = strings.TrimSpace(expectPattern)
-
-		// Handle count-based validation patterns
-		if strings.Contains(expectPattern, "$count < ") || strings.Contains(expectPattern, " > $count") ||
-			strings.Contains(expectPattern, "$count > ") || strings.Contains(expectPattern, " < $count") {
-
-			// Parse numeric response
-			responseNum, err := strconv.Atoi(strings.TrimSpace(response))
-			if err != nil {
-				lastErr = fmt.Errorf("expected numeric response for count validation, got: %s", response)
-				continue
-			}
-
-			// Parse target number
-			var targetNum int
-			var parseErr error
-
-			if strings.Contains(expectPattern, "$count < ") {
-				targetStr := strings.TrimSpace(expectPattern[len("$count <"):])
-				targetNum, parseErr = strconv.Atoi(targetStr)
-				if parseErr == nil && responseNum > targetNum {
-					lastErr = fmt.Errorf("expect: $count < %d but got: %d", targetNum, responseNum)
-				} else {
-					matched = true
-					lastErr = nil
-				}
-			} else if strings.Contains(expectPattern, " > $count") {
-				targetStr := strings.TrimSpace(expectPattern[:strings.Index(expectPattern, "> $count")])
-				targetNum, parseErr = strconv.Atoi(targetStr)
-				if parseErr == nil && responseNum > targetNum {
-					lastErr = fmt.Errorf("expect: %d > $count but got: %d", targetNum, responseNum)
-				} else {
-					matched = true
-					lastErr = nil
-				}
-			} else if strings.Contains(expectPattern, "< $count") {
-				targetStr := strings.TrimSpace(expectPattern[:strings.Index(expectPattern, "< $count")])
-				targetNum, parseErr = strconv.Atoi(targetStr)
-				if parseErr == nil && responseNum < targetNum {
-					lastErr = fmt.Errorf("expect: %d < $count but got: %d", targetNum, responseNum)
-				} else {
-					matched = true
-					lastErr = nil
-				}
-			} else if strings.Contains(expectPattern, "$count >") {
-				targetStr := strings.TrimSpace(expectPattern[len("$count >"):])
-				targetNum, parseErr = strconv.Atoi(targetStr)
-				if parseErr == nil && responseNum < targetNum {
-					lastErr = fmt.Errorf("expect: $count > %d but got: %d", targetNum, responseNum)
-				} else {
-					matched = true
-					lastErr = nil
-				}
-			}
+	now := time.Now().UTC()
+	return FetchedResult{
+		Input:        cf.input,
+		Name:         cf.name,
+		Type:         cf.sType,
+		Error:        errCode,
+		ErrorMessage: errMsg,
+		Content:      doc.Raw,
+		TS:           now.Format("2006-01-02T15:04:05.000"),
+		Timeout:      cf.timeout,
+		TimedOut:     errors.Is(err, ErrTimeout),
+		Duration:     duration,
+		ExitCode:     doc.ExitCode,
+		Stdout:       doc.Stdout,
+		Stderr:       doc.Stderr,
+		StatusCode:   doc.StatusCode,
+		Headers:      doc.Headers,
+		URL:          doc.URL,
+		Connect:      doc.Connect,
+		Tags:         cf.tags,
+		Labels:       cf.labels,
+	}
+}
 
-			if parseErr != nil {
-				lastErr = fmt.Errorf("invalid count validation pattern: %s", expectPattern)
-			}
-		} else {
-			// Handle string-based validation patterns
-			if strings.Contains(response, expectPattern) {
-				matched = true
-				lastErr = nil
-				break
-			} else {
-				lastErr = fmt.Errorf("expect: %s but got: %s", expectPattern, response)
-			}
-		}
+// checkStatus enforces expectStatus against the real HTTP status code and
+// maxLatency against the measured duration
+func (cf *CallFetch) checkStatus(doc ResultDoc, duration time.Duration) error {
+	if len(cf.expectStatus) > 0 && !cf.expectStatus.Match(doc.StatusCode) {
+		return &FetchError{Code: ErrorCodeExpect, Err: fmt.Errorf("expect status %s but got: %d", cf.expectStatus, doc.StatusCode)}
 	}
+	if cf.maxLatency > 0 && duration > cf.maxLatency {
+		return &FetchError{Code: ErrorCodeExpect, Err: fmt.Errorf("expect latency under %v but took: %v", cf.maxLatency, duration)}
+	}
+	return nil
+}
 
-	if !matched && lastErr != nil {
-		return lastErr
+// checkExpect validates the fetched document against the compiled expect
+func (cf *CallFetch) checkExpect(doc ResultDoc, duration time.Duration) error {
+	if cf.programErr != nil {
+		return &FetchError{Code: ErrorCodeExpect, Err: cf.programErr}
+	}
+	if cf.program == nil {
+		return nil
 	}
 
+	if err := cf.program.Eval(newExpectContext(doc, duration)); err != nil {
+		return &FetchError{Code: ErrorCodeExpect, Err: err}
+	}
 	return nil
 }
 
@@ -369,7 +877,7 @@ func (p *Pipeline) Worker() {
 			if err := r.Execute(); err != nil {
 				// Log error for debugging and monitoring
 				// Note: In a production environment, you might want to use a proper logger
-				fmt.Printf("Worker failed to execute command: %v\n", err)
+				fmt.Fprintf(os.Stderr, "Worker failed to execute command: %v\n", err)
 			}
 		case <-p.done:
 			return
@@ -394,159 +902,397 @@ func (p *Pipeline) Stop() {
 	p.wg.Wait()
 }
 
-// ResultDoc represents command execution result
+// ResultDoc represents command or HTTP execution result
 type ResultDoc struct {
-	Raw   string `json:"raw"`
-	Error string `json:"error"`
+	Raw        string        `json:"raw"`
+	Error      string        `json:"error"`
+	Stdout     string        `json:"stdout"`
+	Stderr     string        `json:"stderr"`
+	ExitCode   int           `json:"exitCode"`
+	StatusCode int           `json:"statusCode"`
+	Headers    http.Header   `json:"headers"`
+	URL        string        `json:"url"`
+	Connect    time.Duration `json:"connect"`
+}
+
+// syncWriter serializes writes from concurrent stdout/stderr copies
+type syncWriter struct {
+	mu sync.Mutex
+	w  io.Writer
+}
+
+func (sw *syncWriter) Write(p []byte) (int, error) {
+	sw.mu.Lock()
+	defer sw.mu.Unlock()
+	return sw.w.Write(p)
 }
 
 // fetchHTML fetches HTML content from a URL
 func fetchHTML(input string) (string, error) {
-	return fetchHTTP(input, HTTPMethodGet, nil)
+	doc, err := fetchHTTP(input, HTTPRequest{Method: HTTPMethodGet}, DefaultTimeoutDuration)
+	return doc.Raw, err
 }
 
-// fetchHTTP fetches content from a URL with specified method and data
-func fetchHTTP(input string, method string, data map[string]interface{}) (string, error) {
+// fetchHTTP sends the described request to a URL and reads the response
+func fetchHTTP(input string, spec HTTPRequest, timeout time.Duration) (ResultDoc, error) {
+	var doc ResultDoc
 	if input == "" {
-		return "", nil
+		return doc, nil
 	}
 
-	var req *http.Request
-	var err error
+	method := spec.Method
+	if method == "" {
+		method = HTTPMethodGet
+	}
 
-	if method == HTTPMethodPost && data != nil {
-		jsonData, err := json.Marshal(data)
-		if err != nil {
-			return "", fmt.Errorf("failed to marshal POST data: %w", err)
+	target, err := url.Parse(input)
+	if err != nil {
+		return doc, classifyHTTPError(fmt.Errorf("failed to create %s request: %w", method, err))
+	}
+	if len(spec.Query) > 0 {
+		query := target.Query()
+		for key, values := range spec.Query {
+			for _, value := range values {
+				query.Add(key, value)
+			}
 		}
+		target.RawQuery = query.Encode()
+	}
 
-		req, err = http.NewRequest(HTTPMethodPost, input, bytes.NewBuffer(jsonData))
-		if err != nil {
-			return "", fmt.Errorf("failed to create POST request: %w", err)
-		}
-		req.Header.Set("Content-Type", ContentTypeJSON)
-	} else {
-		req, err = http.NewRequest(method, input, nil)
-		if err != nil {
-			return "", fmt.Errorf("failed to create %s request: %w", method, err)
-		}
+	var body io.Reader
+	if spec.Body != "" {
+		body = strings.NewReader(spec.Body)
+	}
+
+	req, err := http.NewRequest(method, target.String(), body)
+	if err != nil {
+		return doc, classifyHTTPError(fmt.Errorf("failed to create %s request: %w", method, err))
+	}
+	for key, value := range spec.Headers {
+		req.Header.Set(key, value)
+	}
+	if spec.ContentType != "" {
+		req.Header.Set("Content-Type", spec.ContentType)
 	}
 
 	client := &http.Client{
-		Timeout: DefaultTimeoutDuration,
+		Timeout: timeout,
+	}
+	if spec.NoRedirect {
+		client.CheckRedirect = func(*http.Request, []*http.Request) error { return http.ErrUseLastResponse }
 	}
 
 	resp, err := client.Do(req)
 	if err != nil {
-		return "", fmt.Errorf("failed to execute %s request: %w", method, err)
+		var netErr net.Error
+		if errors.As(err, &netErr) && netErr.Timeout() {
+			return doc, classifyHTTPError(fmt.Errorf("%s request %w after %v", method, ErrTimeout, timeout))
+		}
+		return doc, classifyHTTPError(fmt.Errorf("failed to execute %s request: %w", method, err))
 	}
 	defer resp.Body.Close()
 
-	doc, err := io.ReadAll(resp.Body)
+	doc.StatusCode = resp.StatusCode
+	doc.Headers = resp.Header
+	doc.URL = resp.Request.URL.String()
+
+	content, err := io.ReadAll(resp.Body)
 	if err != nil {
-		return "", fmt.Errorf("failed to read response body: %w", err)
+		var netErr net.Error
+		if errors.As(err, &netErr) && netErr.Timeout() {
+			return doc, classifyHTTPError(fmt.Errorf("reading response body %w after %v", ErrTimeout, timeout))
+		}
+		return doc, classifyHTTPError(fmt.Errorf("failed to read response body: %w", err))
 	}
 
-	return string(doc), nil
+	doc.Raw = string(content)
+	return doc, nil
 }
 
-// fetchCmd executes a shell command
-func fetchCmd(input string) (string, error) {
+// fetchTCP dials host:port, optionally sends a payload and reads a banner
+func fetchTCP(input string, spec TCPRequest, timeout time.Duration) (ResultDoc, error) {
+	var doc ResultDoc
 	if input == "" {
-		return "", nil
+		return doc, nil
 	}
 
-	doc, err := exeCmd(input)
+	address := strings.TrimPrefix(input, "tcp://")
+	if _, _, err := net.SplitHostPort(address); err != nil {
+		return doc, &FetchError{Code: ErrorCodeTCP, Err: fmt.Errorf("invalid tcp address %s: %w", input, err)}
+	}
+
+	start := time.Now()
+	conn, err := net.DialTimeout("tcp", address, timeout)
+	doc.Connect = time.Since(start)
 	if err != nil {
-		return doc, fmt.Errorf("command execution failed: %w", err)
+		var netErr net.Error
+		if errors.As(err, &netErr) && netErr.Timeout() {
+			return doc, classifyNetworkError(fmt.Errorf("connect to %s %w after %v", address, ErrTimeout, timeout), ErrorCodeTCP)
+		}
+		return doc, classifyNetworkError(fmt.Errorf("failed to connect to %s: %w", address, err), ErrorCodeTCP)
+	}
+	defer conn.Close()
+
+	doc.Raw = fmt.Sprintf("connected to %s", address)
+	if spec.Send == "" && !spec.Read {
+		return doc, nil
+	}
+
+	conn.SetDeadline(start.Add(timeout))
+	if spec.Send != "" {
+		if _, err := io.WriteString(conn, spec.Send); err != nil {
+			return doc, classifyNetworkError(fmt.Errorf("failed to send to %s: %w", address, err), ErrorCodeTCP)
+		}
+	}
+
+	// A quiet server is not an error; the banner is simply empty
+	buf := make([]byte, TCPBannerSize)
+	n, err := conn.Read(buf)
+	var netErr net.Error
+	if err != nil && err != io.EOF && !(errors.As(err, &netErr) && netErr.Timeout()) {
+		return doc, classifyNetworkError(fmt.Errorf("failed to read from %s: %w", address, err), ErrorCodeTCP)
 	}
+	doc.Raw = string(buf[:n])
 
 	return doc, nil
 }
 
-// exeCmd executes a shell command with timeout
-func exeCmd(str string) (string, error) {
-	parts := strings.Fields(str)
-	if len(parts) == 0 {
-		return "", errors.New("empty command")
+// checkBlocked inverts a tcp probe for block-access checks: a refused or
+// timed out connection is success, a successful connection is a failure
+func checkBlocked(input string, doc ResultDoc, err error) (ResultDoc, error) {
+	if err == nil {
+		return doc, &FetchError{Code: ErrorCodeExpect, Err: fmt.Errorf("expected %s to be blocked but the connection succeeded", input)}
 	}
 
-	cmdName := parts[0]
-	args := parts[1:]
+	switch errorCode(err) {
+	case ErrorCodeConnRefused, ErrorCodeTimeout:
+		doc.Raw = fmt.Sprintf("blocked: %v", err)
+		return doc, nil
+	}
+	return doc, err
+}
 
-	// Clean up arguments
-	for i := range args {
-		if args[i] == "'Content-Type_application/json'" {
-			args[i] = "'Content-Type: application/json'"
-		} else {
-			args[i] = strings.Replace(args[i], "`", " ", -1)
+// fetchCmd executes a command, through the given shell interpreter if set
+func fetchCmd(input string, shell string, timeout time.Duration) (ResultDoc, error) {
+	if input == "" {
+		return ResultDoc{}, nil
+	}
+
+	doc, err := exeCmd(input, shell, timeout)
+	if err != nil {
+		code := ErrorCodeCommand
+		if errors.Is(err, ErrTimeout) {
+			code = ErrorCodeTimeout
 		}
+		return doc, &FetchError{Code: code, Err: fmt.Errorf("command execution failed: %w", err)}
 	}
 
-	ctx, cancel := context.WithTimeout(context.Background(), DefaultTimeoutDuration)
-	defer cancel()
+	return doc, nil
+}
 
-	cmd := exec.CommandContext(ctx, cmdName, args...)
+// exeCmd executes a command with timeout. With a shell interpreter the
+// command runs as `shell -c str`, otherwise str is split into argv.
+func exeCmd(str string, shell string, timeout time.Duration) (ResultDoc, error) {
+	doc := ResultDoc{ExitCode: -1}
 
-	output, err := cmd.CombinedOutput()
-	if err != nil {
-		if ctx.Err() == context.DeadlineExceeded {
-			return "", errors.New("command execution timed out")
+	var cmd *exec.Cmd
+	if shell != "" {
+		if strings.TrimSpace(str) == "" {
+			return doc, errors.New("empty command")
+		}
+		cmd = exec.Command(shell, "-c", str)
+	} else {
+		parts, err := splitArgs(str)
+		if err != nil {
+			return doc, err
+		}
+		if len(parts) == 0 {
+			return doc, errors.New("empty command")
+		}
+		cmd = exec.Command(parts[0], parts[1:]...)
+	}
+
+	// Run in its own process group so a timeout also kills pipeline children
+	cmd.SysProcAttr = &syscall.SysProcAttr{Setpgid: true}
+
+	// Keep stdout and stderr apart while preserving the interleaved output
+	var stdout, stderr, combined bytes.Buffer
+	combinedWriter := &syncWriter{w: &combined}
+	cmd.Stdout = io.MultiWriter(&stdout, combinedWriter)
+	cmd.Stderr = io.MultiWriter(&stderr, combinedWriter)
+
+	if err := cmd.Start(); err != nil {
+		return doc, fmt.Errorf("command failed: %w", err)
+	}
+
+	done := make(chan error, 1)
+	go func() {
+		done <- cmd.Wait()
+	}()
+
+	var err error
+	select {
+	case err = <-done:
+		if err != nil {
+			err = fmt.Errorf("command failed: %w", err)
+		}
+	case <-time.After(timeout):
+		syscall.Kill(-cmd.Process.Pid, syscall.SIGKILL)
+		<-done
+		err = fmt.Errorf("command execution %w after %v", ErrTimeout, timeout)
+	}
+
+	doc.Raw = combined.String()
+	doc.Stdout = stdout.String()
+	doc.Stderr = stderr.String()
+	doc.ExitCode = cmd.ProcessState.ExitCode()
+	return doc, err
+}
+
+// splitArgs splits a command line into argv following POSIX shell quoting
+// rules: single quotes are literal, double quotes allow backslash escapes of
+// $ ` " \ and newline, and a bare backslash escapes the next character.
+func splitArgs(str string) ([]string, error) {
+	var args []string
+	var current strings.Builder
+	inArg := false
+	var quote rune
+	runes := []rune(str)
+
+	for i := 0; i < len(runes); i++ {
+		r := runes[i]
+		switch {
+		case quote == '\'':
+			if r == '\'' {
+				quote = 0
+			} else {
+				current.WriteRune(r)
+			}
+		case quote == '"':
+			if r == '"' {
+				quote = 0
+			} else if r == '\\' && i+1 < len(runes) && strings.ContainsRune("$`\"\\\n", runes[i+1]) {
+				i++
+				current.WriteRune(runes[i])
+			} else {
+				current.WriteRune(r)
+			}
+		case r == '\\':
+			if i+1 >= len(runes) {
+				return nil, fmt.Errorf("trailing backslash in command: %s", str)
+			}
+			i++
+			current.WriteRune(runes[i])
+			inArg = true
+		case r == '\'' || r == '"':
+			quote = r
+			inArg = true
+		case r == ' ' || r == '\t' || r == '\n':
+			if inArg {
+				args = append(args, current.String())
+				current.Reset()
+				inArg = false
+			}
+		default:
+			current.WriteRune(r)
+			inArg = true
 		}
-		return string(output), fmt.Errorf("command failed: %w", err)
 	}
 
-	return string(output), nil
+	if quote != 0 {
+		return nil, fmt.Errorf("unterminated %c quote in command: %s", quote, str)
+	}
+	if inArg {
+		args = append(args, current.String())
+	}
+
+	return args, nil
 }
 
 // execCmd executes commands and returns results
-func (app *App) execCmd(inputs []string, types []string, names []string, expects []string) []map[string]string {
+func (app *App) execCmd(checks []Check) []map[string]interface{} {
+	fetched := app.runChecks(checks)
+	results := make([]map[string]interface{}, 0, len(fetched))
+	for _, result := range fetched {
+		results = append(results, app.formatResult(result))
+	}
+	return results
+}
+
+// runChecks executes all inputs on a worker pool and returns the raw results
+// in input or completion order. Inputs start once the inputs they depend on
+// have finished and are skipped when one of those did not pass.
+func (app *App) runChecks(checks []Check) []FetchedResult {
 	start := time.Now()
 
 	pipeline := NewPipeline()
 	pipeline.Run(app.workerNum)
 	defer pipeline.Stop()
 
-	// Set default values
-	if len(types) == 0 {
-		types = []string{RequestTypeCmd}
-	}
-	if len(names) == 0 {
-		names = []string{app.subject}
-	}
-	if len(expects) == 0 {
-		expects = []string{""}
-	}
-
-	fetchedInput := NewFetchedInput()
-	results := make([]map[string]string, 0, len(inputs))
+	calls := make([]*CallFetch, len(checks))
 
-	// Create and submit fetch requests
-	for i, input := range inputs {
-		sType := types[0]
-		if i < len(types) {
-			sType = types[i]
+	// Create fetch requests
+	for i, check := range checks {
+		sType := check.Type
+		if sType == "" {
+			sType = RequestTypeCmd
 		}
 
-		name := names[0]
-		if i < len(names) {
-			name = names[i]
+		// Reuse the expect compiled while parsing
+		calls[i] = NewCallFetch(pipeline, check.Input, sType, check.Name, "")
+		calls[i].expect = check.Expect
+		calls[i].program, calls[i].programErr = check.compiledExpect()
+		calls[i].timeout = time.Duration(app.timeout) * time.Second
+		if check.Timeout > 0 {
+			calls[i].timeout = check.Timeout
 		}
-
-		expect := ""
-		if i < len(expects) {
-			expect = expects[i]
+		calls[i].shell = check.Shell
+		calls[i].request = check.HTTP
+		calls[i].tcp = check.TCP
+		calls[i].expectFail = check.ExpectFail
+		calls[i].expectStatus = check.ExpectStatus
+		calls[i].maxLatency = check.MaxLatency
+		calls[i].retry = app.retry
+		if check.Retry != nil {
+			calls[i].retry = *check.Retry
 		}
-
-		call := NewCallFetch(fetchedInput, pipeline, input, sType, name, expect)
-		pipeline.request <- call
-
-		// Wait for result
-		result := <-call.result
-
-		// Format result
-		formattedResult := app.formatResult(result)
-		results = append(results, formattedResult)
+		if check.Until > 0 {
+			calls[i].until = check.Until
+			calls[i].interval = check.Interval
+		}
+		if sType == RequestTypeShell && calls[i].shell == "" {
+			calls[i].shell = app.shell
+		}
+		calls[i].tags = check.Tags
+		calls[i].labels = check.Labels
+	}
+
+	// Collect results as they finish
+	fetched := make([]FetchedResult, len(calls))
+	finished := make(chan int, len(calls))
+	for i, call := range calls {
+		go func(i int, call *CallFetch) {
+			fetched[i] = <-call.result
+			finished <- i
+		}(i, call)
+	}
+
+	// Submit every input as soon as its dependencies are done so all workers
+	// stay busy; scheduling runs in its own goroutine because the request
+	// channel may be smaller than inputs
+	completed := make(chan int, len(calls))
+	go scheduleChecks(calls, newDependencyGraph(checks), pipeline, fetched, finished, completed)
+
+	results := make([]FetchedResult, 0, len(calls))
+	if app.order == ResultOrderCompletion {
+		for range calls {
+			results = append(results, fetched[<-completed])
+		}
+	} else {
+		for range calls {
+			<-completed
+		}
+		results = append(results, fetched...)
 	}
 
 	elapsed := time.Since(start)
@@ -556,8 +1302,8 @@ func (app *App) execCmd(inputs []string, types []string, names []string, expects
 }
 
 // formatResult formats a single result based on app configuration
-func (app *App) formatResult(result FetchedResult) map[string]string {
-	formatted := make(map[string]string)
+func (app *App) formatResult(result FetchedResult) map[string]interface{} {
+	formatted := make(map[string]interface{})
 
 	if app.format == "json" {
 		if app.subject != "" {
@@ -567,17 +1313,48 @@ func (app *App) formatResult(result FetchedResult) map[string]string {
 		formatted["name"] = result.Name
 		formatted["errorCode"] = result.Error
 
-		// Handle content encoding
-		var content string
-		if app.base64 == "std" {
-			content = base64.StdEncoding.EncodeToString([]byte(result.Content))
-		} else if app.base64 == "url" {
-			content = base64.URLEncoding.EncodeToString([]byte(result.Content))
-		} else {
-			content = result.Content
-		}
-		formatted["result"] = content
+		formatted["result"] = app.encodeContent(result.Content)
 		formatted["ts"] = result.TS
+		formatted["type"] = result.Type
+		formatted["timeout"] = result.Timeout.String()
+		formatted["timedOut"] = result.TimedOut
+		formatted["durationMs"] = result.Duration.Milliseconds()
+		if result.ErrorMessage != "" {
+			formatted["error"] = result.ErrorMessage
+		}
+		if result.Negated {
+			formatted["negated"] = true
+		}
+		if result.Attempts > 0 {
+			formatted["attempts"] = result.Attempts
+			if len(result.AttemptErrs) > 0 {
+				formatted["attemptErrors"] = result.AttemptErrs
+			}
+		}
+		if len(result.Tags) > 0 {
+			formatted["tags"] = result.Tags
+		}
+		if len(result.Labels) > 0 {
+			formatted["labels"] = result.Labels
+		}
+		if result.Skipped {
+			formatted["skipped"] = true
+		}
+
+		switch result.Type {
+		case RequestTypeCmd, RequestTypeShell:
+			formatted["exitCode"] = result.ExitCode
+			formatted["stdout"] = app.encodeContent(result.Stdout)
+			formatted["stderr"] = app.encodeContent(result.Stderr)
+		case RequestTypeTCP:
+			formatted["connectMs"] = float64(result.Connect.Microseconds()) / 1000
+		default:
+			if result.StatusCode != 0 {
+				formatted["statusCode"] = result.StatusCode
+				formatted["headers"] = result.Headers
+				formatted["url"] = result.URL
+			}
+		}
 	} else {
 		formatted["result"] = result.Content
 	}
@@ -585,10 +1362,25 @@ func (app *App) formatResult(result FetchedResult) map[string]string {
 	return formatted
 }
 
+// encodeContent applies the configured base64 encoding to result content
+func (app *App) encodeContent(content string) string {
+	switch app.base64 {
+	case "std":
+		return base64.StdEncoding.EncodeToString([]byte(content))
+	case "url":
+		return base64.URLEncoding.EncodeToString([]byte(content))
+	default:
+		return content
+	}
+}
+
 // makeResponse creates the response for HTTP requests
-func (app *App) makeResponse(inputs []string, types []string, names []string, expects []string) []byte {
-	result := app.execCmd(inputs, types, names, expects)
+func (app *App) makeResponse(checks []Check) []byte {
+	return app.writeResponse(app.execCmd(checks))
+}
 
+// writeResponse prints formatted results in the configured format
+func (app *App) writeResponse(result []map[string]interface{}) []byte {
 	if app.format == "json" {
 		b, err := json.Marshal(result)
 		if err != nil {
@@ -608,7 +1400,7 @@ func (app *App) makeResponse(inputs []string, types []string, names []string, ex
 		var output strings.Builder
 		for _, r := range result {
 			output.WriteString("\n")
-			output.WriteString(r["result"])
+			output.WriteString(fmt.Sprint(r["result"]))
 			output.WriteString("\n=============================================================\n")
 		}
 		fmt.Print(output.String())
@@ -629,149 +1421,736 @@ func PrettyString(str string) (string, error) {
 	if err := json.Indent(&prettyJSON, []byte(str), "", "    "); err != nil {
 		return "", err
 	}
-	return prettyJSON.String(), nil
-}
+	return prettyJSON.String(), nil
+}
+
+// HTTP handlers
+func (app *App) getHandle(w http.ResponseWriter, r *http.Request) {
+	sType := r.URL.Query().Get(":type")
+	name := r.URL.Query().Get(":name")
+	paramStr := r.URL.Query().Get(":params")
+
+	app.logger.Debugf("GET request - type: %s, name: %s, params: %s", sType, name, paramStr)
+
+	selector, err := requestSelector(r)
+	if err != nil {
+		app.logger.Warningf("Invalid selection: %v", err)
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	response := app.makeResponse(selector.Select(app.parseInputParams(paramStr)))
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(response)
+}
+
+func (app *App) postHandle(w http.ResponseWriter, r *http.Request) {
+	if err := r.ParseForm(); err != nil {
+		app.logger.Errorf("Failed to parse form: %v", err)
+		http.Error(w, "Bad request", http.StatusBadRequest)
+		return
+	}
+
+	sType := r.FormValue("type")
+	if sType == "" {
+		app.logger.Warning("Missing type parameter")
+		http.Error(w, "Missing type parameter", http.StatusBadRequest)
+		return
+	}
+
+	name := r.FormValue("name")
+	paramStr := r.FormValue("params")
+	if paramStr == "" {
+		app.logger.Warning("Missing params parameter")
+		http.Error(w, "Missing params parameter", http.StatusBadRequest)
+		return
+	}
+
+	app.logger.Debugf("POST request - type: %s, name: %s, params: %s", sType, name, paramStr)
+
+	selector, err := requestSelector(r)
+	if err != nil {
+		app.logger.Warningf("Invalid selection: %v", err)
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	response := app.makeResponse(selector.Select(app.parseInputParams(paramStr)))
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(response)
+}
+
+// configInputs returns the config file inputs: those in the legacy
+// request.input JSON string followed by the request.inputs list
+func (app *App) configInputs() []Check {
+	var configs []InputConfig
+	if app.config.Request.Input != "" {
+		decoded, err := app.decodeConfigInput(app.config.Request.Input)
+		if err != nil {
+			app.logger.Errorf("Failed to unmarshal config input: %v", err)
+		}
+		configs = append(configs, decoded...)
+	}
+	configs = append(configs, app.config.Request.Inputs...)
+	return app.parseInputConfigs(configs)
+}
+
+// decodeConfigInput decodes {"inputs": [...]} into input configs
+func (app *App) decodeConfigInput(inputStr string) ([]InputConfig, error) {
+	var data struct {
+		Inputs []map[string]interface{} `json:"inputs"`
+	}
+	if err := json.Unmarshal([]byte(inputStr), &data); err != nil {
+		return nil, err
+	}
+	return app.decodeInputItems(data.Inputs), nil
+}
+
+// decodeInputItems decodes input item maps, logging fields that could not be read
+func (app *App) decodeInputItems(items []map[string]interface{}) []InputConfig {
+	configs := make([]InputConfig, len(items))
+	for i, item := range items {
+		cfg, err := decodeInputConfig(item)
+		if err != nil {
+			app.logger.Warningf("Ignoring invalid fields for input %v: %v", item["input"], err)
+		}
+		configs[i] = cfg
+	}
+	return configs
+}
+
+// parseInputItems turns decoded input items into checks
+func (app *App) parseInputItems(items []map[string]interface{}) []Check {
+	return app.parseInputConfigs(app.decodeInputItems(items))
+}
+
+// parseInputConfigs turns input configs into checks, expanding matrix
+// inputs into one check per combination. Inputs without a type use
+// request.type, then cmd; inputs without a name use the subject.
+func (app *App) parseInputConfigs(configs []InputConfig) []Check {
+	defaultType := RequestTypeCmd
+	if app.config != nil && app.config.Request.Type != "" {
+		defaultType = app.config.Request.Type
+	}
+
+	var expanded []InputConfig
+	for _, cfg := range configs {
+		rendered, err := expandInputConfig(cfg, app.vars)
+		if err != nil {
+			app.logger.Errorf("Skipping input %v: %v", cfg.Input, err)
+			continue
+		}
+		expanded = append(expanded, rendered...)
+	}
+
+	checks := make([]Check, 0, len(expanded))
+	for _, cfg := range expanded {
+		check := Check{
+			Input:        cfg.Input,
+			Type:         cfg.Type,
+			Name:         cfg.Name,
+			Expect:       cfg.Expect,
+			InputOptions: app.inputOptions(cfg),
+		}
+		if check.Type == "" {
+			check.Type = defaultType
+		}
+		if check.Name == "" {
+			check.Name = app.subject
+		}
+		checks = append(checks, check)
+	}
+	return checks
+}
+
+// CLIInputs holds the ad-hoc inputs given on the command line
+type CLIInputs struct {
+	List    string   // -i: comma separated inputs, @file, or - for stdin
+	Inputs  []string // repeated --input, never split on commas
+	Expects []string // repeated --expect, matched to inputs by position
+	Names   []string // repeated --name, matched to inputs by position
+	Types   []string // repeated --type, matched to inputs by position
+	Type    string   // -t: default type
+	Name    string   // -n: default name
+}
+
+// parseCLIInputs turns command line inputs into input items. Each input may
+// carry its expect as "input::expect"; @file and stdin are read one input per
+// line, either in that form or as a JSON object like the config file inputs.
+func (app *App) parseCLIInputs(cli CLIInputs, stdin io.Reader) ([]Check, error) {
+	var items []map[string]interface{}
+	switch {
+	case cli.List == "-":
+		lines, err := readInputItems(stdin, "stdin")
+		if err != nil {
+			return nil, err
+		}
+		items = lines
+	case strings.HasPrefix(cli.List, "@"):
+		f, err := os.Open(cli.List[1:])
+		if err != nil {
+			return nil, fmt.Errorf("failed to read inputs: %w", err)
+		}
+		defer f.Close()
+		lines, err := readInputItems(f, cli.List[1:])
+		if err != nil {
+			return nil, err
+		}
+		items = lines
+	case cli.List != "":
+		for _, spec := range strings.Split(cli.List, ",") {
+			if spec = strings.TrimSpace(spec); spec != "" {
+				items = append(items, inputItem(spec))
+			}
+		}
+	}
+	for _, spec := range cli.Inputs {
+		items = append(items, inputItem(spec))
+	}
+	if len(items) == 0 {
+		return nil, fmt.Errorf("no inputs given")
+	}
+
+	// Fill what each item leaves out from the positional flags, then the
+	// defaults, so the parsed slices stay aligned
+	for i, item := range items {
+		if _, ok := item["expect"]; !ok && i < len(cli.Expects) && cli.Expects[i] != "" {
+			item["expect"] = cli.Expects[i]
+		}
+		if _, ok := item["name"]; !ok {
+			item["name"] = cli.Name
+			if i < len(cli.Names) {
+				item["name"] = cli.Names[i]
+			}
+		}
+		if _, ok := item["type"]; !ok {
+			input, _ := item["input"].(string)
+			item["type"] = defaultInputType(input, cli.Type)
+			if i < len(cli.Types) {
+				item["type"] = cli.Types[i]
+			}
+		}
+	}
+
+	var diagnostics []Diagnostic
+	for i, item := range items {
+		for _, problem := range checkInputTemplates(item, "", app.vars) {
+			diagnostics = append(diagnostics, Diagnostic{Message: fmt.Sprintf("input %s: %s", inputItemLabel(i, item), problem)})
+		}
+	}
+	if len(diagnostics) > 0 {
+		return nil, &ValidationError{Diagnostics: diagnostics}
+	}
+
+	return app.parseInputItems(items), nil
+}
+
+// readInputItems reads one input per line, skipping blank lines and # comments
+func readInputItems(r io.Reader, source string) ([]map[string]interface{}, error) {
+	var items []map[string]interface{}
+	scanner := bufio.NewScanner(r)
+	for lineNo := 1; scanner.Scan(); lineNo++ {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		if !strings.HasPrefix(line, "{") {
+			items = append(items, inputItem(line))
+			continue
+		}
+
+		var item map[string]interface{}
+		if err := json.Unmarshal([]byte(line), &item); err != nil {
+			return nil, fmt.Errorf("%s:%d: invalid JSON: %w", source, lineNo, err)
+		}
+		if input, _ := item["input"].(string); input == "" {
+			return nil, fmt.Errorf("%s:%d: missing input", source, lineNo)
+		}
+		items = append(items, item)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read %s: %w", source, err)
+	}
+	return items, nil
+}
+
+// inputItem parses "input::expect" into an input item. The separator is the
+// last "::" outside brackets so IPv6 hosts like http://[::1]/ stay intact.
+func inputItem(spec string) map[string]interface{} {
+	depth, split := 0, -1
+	for i := 0; i < len(spec); i++ {
+		switch spec[i] {
+		case '[':
+			depth++
+		case ']':
+			depth--
+		case ':':
+			if depth == 0 && strings.HasPrefix(spec[i:], "::") {
+				split = i
+				i++
+			}
+		}
+	}
+
+	if split < 0 {
+		return map[string]interface{}{"input": strings.TrimSpace(spec)}
+	}
+	return map[string]interface{}{
+		"input":  strings.TrimSpace(spec[:split]),
+		"expect": strings.TrimSpace(spec[split+2:]),
+	}
+}
+
+// defaultInputType picks the type for a command line input: URLs use an HTTP
+// type (get unless -t names another), other inputs run as commands unless -t
+// is sh or tcp
+func defaultInputType(input, requestType string) string {
+	isURL := strings.HasPrefix(input, "http://") || strings.HasPrefix(input, "https://")
+	switch requestType {
+	case RequestTypeCmd, RequestTypeShell, RequestTypeTCP, "":
+		if isURL {
+			return RequestTypeGet
+		}
+		if requestType == "" {
+			return RequestTypeCmd
+		}
+		return requestType
+	default:
+		if isURL {
+			return requestType
+		}
+		return RequestTypeCmd
+	}
+}
+
+// parseInputParams parses input parameters from JSON or base64 encoded string
+func (app *App) parseInputParams(paramStr string) []Check {
+	type Inputs struct {
+		Inputs []map[string]interface{} `json:"inputs"`
+	}
+
+	var data Inputs
+
+	// Try base64 decode first
+	if decoded, err := base64.StdEncoding.DecodeString(paramStr); err == nil {
+		if err := json.Unmarshal(decoded, &data); err != nil {
+			app.logger.Errorf("Failed to unmarshal base64 decoded params: %v", err)
+		}
+	} else {
+		// Try direct JSON unmarshal
+		if err := json.Unmarshal([]byte(paramStr), &data); err != nil {
+			app.logger.Errorf("Failed to unmarshal params: %v", err)
+		}
+	}
+
+	return app.parseInputItems(data.Inputs)
+}
+
+// parseInputOptions extracts optional per-input settings from an input item
+func (app *App) parseInputOptions(item map[string]interface{}) InputOptions {
+	cfg, err := decodeInputConfig(item)
+	if err != nil {
+		app.logger.Warningf("Ignoring invalid fields for input %v: %v", item["input"], err)
+	}
+	return app.inputOptions(cfg)
+}
+
+// inputOptions resolves the optional per-input settings of an input config
+func (app *App) inputOptions(cfg InputConfig) InputOptions {
+	var opts InputOptions
+
+	// Compile the expect once, reporting a malformed one while loading
+	// rather than on every execution
+	if cfg.Expect != "" {
+		prog, err := compileExpect(cfg.Expect)
+		if err != nil {
+			app.logger.Errorf("Invalid expect for input %v: %v", cfg.Input, err)
+		}
+		opts.ExpectProgram = prog
+	}
+
+	if cfg.Timeout != nil {
+		d, err := parseTimeout(cfg.Timeout)
+		if err != nil {
+			app.logger.Warningf("Ignoring invalid timeout for input %v: %v", cfg.Input, err)
+		} else {
+			opts.Timeout = d
+		}
+	}
+
+	switch shell := cfg.Shell.(type) {
+	case bool:
+		if shell {
+			opts.Shell = app.shell
+		}
+	case string:
+		opts.Shell = shell
+	}
+
+	opts.HTTP = app.parseHTTPRequest(cfg)
+	opts.TCP = TCPRequest{Send: cfg.Send, Read: cfg.Read, Blocked: cfg.Blocked}
+
+	// negate is accepted as an alias of expectFail
+	opts.ExpectFail = cfg.ExpectFail || cfg.Negate
+
+	if cfg.ExpectStatus != nil {
+		ranges, err := parseExpectStatus(cfg.ExpectStatus)
+		if err != nil {
+			app.logger.Errorf("Invalid expectStatus for input %v: %v", cfg.Input, err)
+		} else {
+			opts.ExpectStatus = ranges
+		}
+	}
+
+	if cfg.MaxLatency != nil {
+		d, err := parseLatency(cfg.MaxLatency)
+		if err != nil {
+			app.logger.Warningf("Ignoring invalid maxLatency for input %v: %v", cfg.Input, err)
+		} else {
+			opts.MaxLatency = d
+		}
+	}
+
+	opts.Retry = app.parseRetryPolicy(cfg)
+
+	// until is the deadline for polling an input until it passes; true uses the default
+	switch until := cfg.Until.(type) {
+	case nil:
+	case bool:
+		if until {
+			opts.Until = DefaultWaitDeadline
+		}
+	default:
+		d, err := parseTimeout(until)
+		if err != nil {
+			app.logger.Warningf("Ignoring invalid until for input %v: %v", cfg.Input, err)
+		} else {
+			opts.Until = d
+		}
+	}
+	if cfg.Interval != nil {
+		d, err := parseTimeout(cfg.Interval)
+		if err != nil {
+			app.logger.Warningf("Ignoring invalid interval for input %v: %v", cfg.Input, err)
+		} else {
+			opts.Interval = d
+		}
+	}
 
-// HTTP handlers
-func (app *App) getHandle(w http.ResponseWriter, r *http.Request) {
-	sType := r.URL.Query().Get(":type")
-	name := r.URL.Query().Get(":name")
-	paramStr := r.URL.Query().Get(":params")
+	if cfg.Tags != nil {
+		tags, err := parseStringList(cfg.Tags)
+		if err != nil {
+			app.logger.Warningf("Ignoring invalid tags for input %v: %v", cfg.Input, err)
+		} else {
+			opts.Tags = tags
+		}
+	}
+	if len(cfg.Labels) > 0 {
+		opts.Labels = cfg.Labels
+	}
+	if cfg.DependsOn != nil {
+		deps, err := parseStringList(cfg.DependsOn)
+		if err != nil {
+			app.logger.Warningf("Ignoring invalid dependsOn for input %v: %v", cfg.Input, err)
+		} else {
+			opts.DependsOn = deps
+		}
+	}
 
-	app.logger.Debugf("GET request - type: %s, name: %s, params: %s", sType, name, paramStr)
+	return opts
+}
 
-	inputs, types, names, expects := app.parseInputParams(paramStr)
-	response := app.makeResponse(inputs, types, names, expects)
+// parseHTTPRequest resolves method, headers, body, query and contentType of an input config
+func (app *App) parseHTTPRequest(cfg InputConfig) HTTPRequest {
+	var req HTTPRequest
 
-	w.Header().Set("Content-Type", "application/json")
-	w.Write(response)
-}
+	if method := strings.ToUpper(cfg.Method); method != "" {
+		if httpMethods[method] {
+			req.Method = method
+		} else {
+			app.logger.Warningf("Ignoring unsupported method %s for input %v", method, cfg.Input)
+		}
+	}
 
-func (app *App) postHandle(w http.ResponseWriter, r *http.Request) {
-	if err := r.ParseForm(); err != nil {
-		app.logger.Errorf("Failed to parse form: %v", err)
-		http.Error(w, "Bad request", http.StatusBadRequest)
-		return
+	if len(cfg.Headers) > 0 {
+		req.Headers = cfg.Headers
 	}
 
-	sType := r.FormValue("type")
-	if sType == "" {
-		app.logger.Warning("Missing type parameter")
-		http.Error(w, "Missing type parameter", http.StatusBadRequest)
-		return
+	switch body := cfg.Body.(type) {
+	case nil:
+	case string:
+		req.Body = body
+	default:
+		// Structured bodies are sent as JSON
+		data, err := json.Marshal(jsonValue(body))
+		if err != nil {
+			app.logger.Warningf("Ignoring invalid body for input %v: %v", cfg.Input, err)
+		} else {
+			req.Body = string(data)
+			if !hasHeader(cfg.Headers, "Content-Type") {
+				req.ContentType = ContentTypeJSON
+			}
+		}
 	}
 
-	name := r.FormValue("name")
-	paramStr := r.FormValue("params")
-	if paramStr == "" {
-		app.logger.Warning("Missing params parameter")
-		http.Error(w, "Missing params parameter", http.StatusBadRequest)
-		return
+	if len(cfg.Query) > 0 {
+		req.Query = url.Values{}
+		for key, value := range cfg.Query {
+			switch values := value.(type) {
+			case []interface{}:
+				for _, v := range values {
+					req.Query.Add(key, fmt.Sprint(v))
+				}
+			case []string:
+				for _, v := range values {
+					req.Query.Add(key, v)
+				}
+			default:
+				req.Query.Add(key, fmt.Sprint(value))
+			}
+		}
 	}
 
-	app.logger.Debugf("POST request - type: %s, name: %s, params: %s", sType, name, paramStr)
+	if cfg.ContentType != "" {
+		req.ContentType = cfg.ContentType
+	}
 
-	inputs, types, names, expects := app.parseInputParams(paramStr)
-	response := app.makeResponse(inputs, types, names, expects)
+	return req
+}
 
-	w.Header().Set("Content-Type", "application/json")
-	w.Write(response)
+// hasHeader reports whether headers sets name, ignoring case
+func hasHeader(headers map[string]string, name string) bool {
+	for key := range headers {
+		if strings.EqualFold(key, name) {
+			return true
+		}
+	}
+	return false
 }
 
-// parseConfigInput parses input configuration from config file
-func (app *App) parseConfigInput(inputStr string) ([]string, []string, []string, []string) {
-	type Inputs struct {
-		Inputs []map[string]interface{} `json:"inputs"`
+// jsonValue converts maps decoded from YAML, which may have non-string keys,
+// into values encoding/json can marshal
+func jsonValue(value interface{}) interface{} {
+	switch v := value.(type) {
+	case map[interface{}]interface{}:
+		m := make(map[string]interface{}, len(v))
+		for key, item := range v {
+			m[fmt.Sprint(key)] = jsonValue(item)
+		}
+		return m
+	case map[string]interface{}:
+		m := make(map[string]interface{}, len(v))
+		for key, item := range v {
+			m[key] = jsonValue(item)
+		}
+		return m
+	case []interface{}:
+		items := make([]interface{}, len(v))
+		for i, item := range v {
+			items[i] = jsonValue(item)
+		}
+		return items
+	default:
+		return value
 	}
+}
 
-	var data Inputs
-	if err := json.Unmarshal([]byte(inputStr), &data); err != nil {
-		app.logger.Errorf("Failed to unmarshal config input: %v", err)
-		return nil, nil, nil, nil
+// parseTimeout converts seconds (number or numeric string) or a duration string like "500ms"
+func parseTimeout(value interface{}) (time.Duration, error) {
+	switch v := value.(type) {
+	case float64:
+		return time.Duration(v * float64(time.Second)), nil
+	case int:
+		return time.Duration(v) * time.Second, nil
+	case string:
+		if secs, err := strconv.ParseFloat(v, 64); err == nil {
+			return time.Duration(secs * float64(time.Second)), nil
+		}
+		return time.ParseDuration(v)
+	default:
+		return 0, fmt.Errorf("unsupported timeout value: %v", value)
 	}
+}
 
-	var inputs, types, names, expects []string
+// parseRetryPolicy reads retries, retryDelay and retryOn from an input config,
+// starting from the global policy. It returns nil when none are set.
+func (app *App) parseRetryPolicy(cfg InputConfig) *RetryPolicy {
+	if cfg.Retries == nil && cfg.RetryDelay == nil && cfg.RetryOn == nil {
+		return nil
+	}
 
-	for _, item := range data.Inputs {
-		if input, exists := item["input"]; exists {
-			if str, ok := input.(string); ok {
-				inputs = append(inputs, str)
-			}
-		}
-		if inputType, exists := item["type"]; exists {
-			if str, ok := inputType.(string); ok {
-				types = append(types, str)
-			}
-		}
-		if name, exists := item["name"]; exists {
-			if str, ok := name.(string); ok {
-				names = append(names, str)
-			}
+	policy := app.retry
+	if cfg.Retries != nil {
+		policy.Retries = *cfg.Retries
+	}
+	if cfg.RetryDelay != nil {
+		d, err := parseTimeout(cfg.RetryDelay)
+		if err != nil {
+			app.logger.Warningf("Ignoring invalid retryDelay for input %v: %v", cfg.Input, err)
+		} else {
+			policy.Delay = d
 		}
-		if expect, exists := item["expect"]; exists {
-			if str, ok := expect.(string); ok {
-				expects = append(expects, str)
-			} else {
-				expects = append(expects, "")
-			}
+	}
+	if cfg.RetryOn != nil {
+		on, err := parseRetryOn(cfg.RetryOn)
+		if err != nil {
+			app.logger.Warningf("Ignoring invalid retryOn for input %v: %v", cfg.Input, err)
 		} else {
-			expects = append(expects, "")
+			policy.On = on
 		}
 	}
-
-	return inputs, types, names, expects
+	return &policy
 }
 
-// parseInputParams parses input parameters from JSON or base64 encoded string
-func (app *App) parseInputParams(paramStr string) ([]string, []string, []string, []string) {
-	type Inputs struct {
-		Inputs []map[string]interface{} `json:"inputs"`
+// parseRetryOn reads retry conditions from a list or a comma separated string
+func parseRetryOn(value interface{}) ([]string, error) {
+	var conditions []string
+	switch v := value.(type) {
+	case string:
+		conditions = strings.Split(v, ",")
+	case []string:
+		conditions = v
+	case []interface{}:
+		for _, item := range v {
+			conditions = append(conditions, fmt.Sprint(item))
+		}
+	default:
+		return nil, fmt.Errorf("unsupported retryOn value: %v", value)
 	}
 
-	var data Inputs
+	on := make([]string, 0, len(conditions))
+	for _, condition := range conditions {
+		condition = strings.ToLower(strings.TrimSpace(condition))
+		switch condition {
+		case "":
+			continue
+		case RetryOnTimeout, RetryOnConnect, RetryOnExpect, RetryOn5xx:
+			on = append(on, condition)
+		default:
+			return nil, fmt.Errorf("unknown retry condition %q", condition)
+		}
+	}
+	return on, nil
+}
 
-	// Try base64 decode first
-	if decoded, err := base64.StdEncoding.DecodeString(paramStr); err == nil {
-		if err := json.Unmarshal(decoded, &data); err != nil {
-			app.logger.Errorf("Failed to unmarshal base64 decoded params: %v", err)
+// parseStringList reads tags or names from a list or a comma separated string
+func parseStringList(value interface{}) ([]string, error) {
+	var values []string
+	switch v := value.(type) {
+	case string:
+		values = strings.Split(v, ",")
+	case []string:
+		values = v
+	case []interface{}:
+		for _, item := range v {
+			values = append(values, fmt.Sprint(item))
 		}
-	} else {
-		// Try direct JSON unmarshal
-		if err := json.Unmarshal([]byte(paramStr), &data); err != nil {
-			app.logger.Errorf("Failed to unmarshal params: %v", err)
+	default:
+		return nil, fmt.Errorf("unsupported list value: %v", value)
+	}
+
+	list := make([]string, 0, len(values))
+	for _, value := range values {
+		if value = strings.TrimSpace(value); value != "" {
+			list = append(list, value)
 		}
 	}
+	return list, nil
+}
 
-	var inputs, types, names, expects []string
+// parseLatency converts a maxLatency value into a duration. Numbers are
+// milliseconds, strings may also be durations like "500ms" or "1.5s".
+func parseLatency(value interface{}) (time.Duration, error) {
+	switch v := value.(type) {
+	case float64:
+		return time.Duration(v * float64(time.Millisecond)), nil
+	case int:
+		return time.Duration(v) * time.Millisecond, nil
+	case string:
+		if ms, err := strconv.ParseFloat(v, 64); err == nil {
+			return time.Duration(ms * float64(time.Millisecond)), nil
+		}
+		return time.ParseDuration(v)
+	default:
+		return 0, fmt.Errorf("unsupported latency value: %v", value)
+	}
+}
 
-	for _, item := range data.Inputs {
-		if input, exists := item["input"]; exists {
-			if str, ok := input.(string); ok {
-				inputs = append(inputs, str)
+// parseExpectStatus reads status codes from a number, a list, or a string of
+// codes separated by "," or "|". Codes may be exact (200), classes (2xx) or
+// ranges (200-299).
+func parseExpectStatus(value interface{}) (StatusRanges, error) {
+	var specs []string
+	switch v := value.(type) {
+	case float64:
+		specs = []string{strconv.Itoa(int(v))}
+	case int:
+		specs = []string{strconv.Itoa(v)}
+	case string:
+		specs = strings.FieldsFunc(v, func(r rune) bool { return r == ',' || r == '|' })
+	case []interface{}:
+		for _, item := range v {
+			switch code := item.(type) {
+			case float64:
+				specs = append(specs, strconv.Itoa(int(code)))
+			case int:
+				specs = append(specs, strconv.Itoa(code))
+			case string:
+				specs = append(specs, code)
+			default:
+				return nil, fmt.Errorf("unsupported status value: %v", item)
 			}
 		}
-		if inputType, exists := item["type"]; exists {
-			if str, ok := inputType.(string); ok {
-				types = append(types, str)
-			}
+	default:
+		return nil, fmt.Errorf("unsupported expectStatus value: %v", value)
+	}
+
+	var ranges StatusRanges
+	for _, spec := range specs {
+		spec = strings.ToLower(strings.TrimSpace(spec))
+		if spec == "" {
+			continue
 		}
-		if name, exists := item["name"]; exists {
-			if str, ok := name.(string); ok {
-				names = append(names, str)
-			}
+		r, err := parseStatusRange(spec)
+		if err != nil {
+			return nil, err
 		}
-		if expect, exists := item["expect"]; exists {
-			if str, ok := expect.(string); ok {
-				expects = append(expects, str)
-			} else {
-				expects = append(expects, "")
-			}
-		} else {
-			expects = append(expects, "")
+		ranges = append(ranges, r)
+	}
+	if len(ranges) == 0 {
+		return nil, fmt.Errorf("no status codes in %v", value)
+	}
+	return ranges, nil
+}
+
+// parseStatusRange parses one of 200, 2xx or 200-299
+func parseStatusRange(spec string) (StatusRange, error) {
+	if len(spec) == 3 && strings.HasSuffix(spec, "xx") {
+		class, err := strconv.Atoi(spec[:1])
+		if err != nil || class < 1 || class > 5 {
+			return StatusRange{}, fmt.Errorf("invalid status class %q", spec)
 		}
+		return StatusRange{Min: class * 100, Max: class*100 + 99}, nil
 	}
 
-	return inputs, types, names, expects
+	low, high := spec, spec
+	if i := strings.Index(spec, "-"); i > 0 {
+		low, high = spec[:i], spec[i+1:]
+	}
+	lo, err := strconv.Atoi(strings.TrimSpace(low))
+	if err != nil {
+		return StatusRange{}, fmt.Errorf("invalid status code %q", spec)
+	}
+	hi, err := strconv.Atoi(strings.TrimSpace(high))
+	if err != nil {
+		return StatusRange{}, fmt.Errorf("invalid status code %q", spec)
+	}
+	if lo < 100 || hi > 599 || lo > hi {
+		return StatusRange{}, fmt.Errorf("invalid status range %q", spec)
+	}
+	return StatusRange{Min: lo, Max: hi}, nil
 }
 
 // webserver starts the HTTP server
@@ -789,8 +2168,16 @@ func (app *App) webserver() {
 	r.Get("/healthcheck", func(w http.ResponseWriter, r *http.Request) {
 		fmt.Fprintf(w, "OK")
 	})
-	r.Get("/mcall/{type}/{params}", app.getHandle)
-	r.Post("/mcall", app.postHandle)
+	// Handlers run on the active config so reloads apply to the next request
+	r.Get("/config", func(w http.ResponseWriter, r *http.Request) {
+		app.active().configHandle(w, r)
+	})
+	r.Get("/mcall/{type}/{params}", func(w http.ResponseWriter, r *http.Request) {
+		app.active().getHandle(w, r)
+	})
+	r.Post("/mcall", func(w http.ResponseWriter, r *http.Request) {
+		app.active().postHandle(w, r)
+	})
 
 	http.Handle("/", r)
 
@@ -810,15 +2197,22 @@ func NewApp(config *Config) *App {
 		timeout:   config.Request.Timeout,
 		subject:   config.Request.Subject,
 		format:    config.Response.Format,
+		order:     config.Response.Order,
 		base64:    config.Response.Encoding.Type,
+		shell:     config.Request.Shell,
+		retry: RetryPolicy{
+			Retries: config.Request.Retries,
+			On:      config.Request.RetryOn,
+		},
 		esConfig: ESConfig{
 			Host:      config.Response.ES.Host,
 			ID:        config.Response.ES.ID,
 			Password:  config.Response.ES.Password,
 			IndexName: config.Response.ES.IndexName,
 		},
-		namespace: "default",
-		lockName:  "tz-mcall-leader",
+		exitPolicy: ExitPolicy{FailOn: FailOnAny},
+		namespace:  "default",
+		lockName:   "tz-mcall-leader",
 	}
 
 	// Set defaults
@@ -831,6 +2225,17 @@ func NewApp(config *Config) *App {
 	if app.format == "" {
 		app.format = DefaultFormat
 	}
+	if app.order == "" {
+		app.order = DefaultResultOrder
+	}
+	if app.shell == "" {
+		app.shell = DefaultShell
+	}
+	if config.Request.RetryDelay != "" {
+		if d, err := parseTimeout(config.Request.RetryDelay); err == nil {
+			app.retry.Delay = d
+		}
+	}
 
 	return app
 }
@@ -872,23 +2277,43 @@ func setupLogging(config *Config) (*logging.Logger, error) {
 	return logging.MustGetLogger("mcall"), nil
 }
 
-// loadConfig loads configuration from file or sets defaults
+// loadConfig loads a configuration file, or the defaults when configFile is empty
 func loadConfig(configFile string) (*Config, error) {
+	var files []string
+	if configFile != "" {
+		files = []string{configFile}
+	}
+	return loadConfigFiles(files, "")
+}
+
+// loadConfigFiles loads configuration from files merged in order, with the
+// named profile overlaid, or sets defaults. Values in the files are
+// interpolated first, and every key can also be set from the environment as
+// MCALL_<SECTION>_<KEY> or one of its envAliases, which win over the files.
+func loadConfigFiles(files []string, profile string) (*Config, error) {
 	config := &Config{}
 
-	if configFile != "" {
-		viper.SetConfigFile(configFile)
-		viper.SetConfigType("yaml")
+	v := viper.New()
+	v.SetConfigType("yaml")
+	v.SetEnvPrefix(EnvPrefix)
+	v.SetEnvKeyReplacer(strings.NewReplacer(".", "_"))
+	v.AutomaticEnv()
+	bindConfigEnv(v, reflect.TypeOf(*config), "")
 
-		if err := viper.ReadInConfig(); err != nil {
+	if len(files) > 0 {
+		data, err := readConfigFiles(files, profile)
+		if err != nil {
 			return nil, fmt.Errorf("failed to read config file: %w", err)
 		}
-
-		if err := viper.Unmarshal(config); err != nil {
-			return nil, fmt.Errorf("failed to unmarshal config: %w", err)
+		if err := v.ReadConfig(bytes.NewReader(data)); err != nil {
+			return nil, fmt.Errorf("failed to read config file: %w", err)
 		}
 	}
 
+	if err := v.Unmarshal(config); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal config: %w", err)
+	}
+
 	// Set defaults for missing values
 	if config.Worker.Number == 0 {
 		config.Worker.Number = DefaultWorkerNum
@@ -902,9 +2327,15 @@ func loadConfig(configFile string) (*Config, error) {
 	if config.Response.Format == "" {
 		config.Response.Format = DefaultFormat
 	}
+	if config.Response.Order == "" {
+		config.Response.Order = DefaultResultOrder
+	}
 	if config.Request.Timeout == 0 {
 		config.Request.Timeout = DefaultTimeout
 	}
+	if config.Request.Shell == "" {
+		config.Request.Shell = DefaultShell
+	}
 	if config.Log.Level == "" {
 		config.Log.Level = DefaultLogLevel
 	}
@@ -918,6 +2349,36 @@ func loadConfig(configFile string) (*Config, error) {
 // Args represents command line arguments
 type Args map[string]interface{}
 
+// Has reports whether an argument was given
+func (a Args) Has(key string) bool {
+	_, ok := a[key]
+	return ok
+}
+
+// String returns a string argument, or "" when it is missing
+func (a Args) String(key string) string {
+	v, _ := a[key].(string)
+	return v
+}
+
+// Bool returns a boolean argument, or false when it is missing
+func (a Args) Bool(key string) bool {
+	v, _ := a[key].(bool)
+	return v
+}
+
+// Int returns an integer argument, or 0 when it is missing
+func (a Args) Int(key string) int {
+	v, _ := a[key].(int)
+	return v
+}
+
+// Strings returns a repeated argument, or nil when it is missing
+func (a Args) Strings(key string) []string {
+	v, _ := a[key].([]string)
+	return v
+}
+
 // createKubernetesClient creates a Kubernetes client
 func (app *App) createKubernetesClient() error {
 	var config *rest.Config
@@ -1067,8 +2528,8 @@ func (app *App) distributeTasks(ctx context.Context) error {
 
 	app.logger.Infof("Found %d worker pods: %v", len(workerPods), workerPods)
 
-	// Create tasks to distribute
-	tasks := app.generateTasks()
+	// Create tasks to distribute from the active config
+	tasks := app.active().generateTasks()
 
 	if len(tasks) == 0 {
 		app.logger.Info("No tasks to distribute")
@@ -1095,31 +2556,51 @@ func (app *App) distributeTasks(ctx context.Context) error {
 func (app *App) generateTasks() []map[string]interface{} {
 	var tasks []map[string]interface{}
 
-	// Only generate tasks if config has input tasks
-	if app.config.Request.Input != "" {
-		inputs, types, names, expects := app.parseConfigInput(app.config.Request.Input)
-		tasks = make([]map[string]interface{}, len(inputs))
+	// Only generate tasks if config has selected input tasks
+	if checks := app.selector.Select(app.configInputs()); len(checks) > 0 {
+		tasks = make([]map[string]interface{}, len(checks))
 
-		for i, input := range inputs {
-			taskType := RequestTypeCmd
-			if i < len(types) {
-				taskType = types[i]
+		for i, check := range checks {
+			tasks[i] = map[string]interface{}{
+				"id":      fmt.Sprintf("task-%d", i+1),
+				"command": check.Input,
+				"type":    check.Type,
+				"name":    check.Name,
+				"expect":  check.Expect,
 			}
-			taskName := app.subject
-			if i < len(names) {
-				taskName = names[i]
+			if check.Timeout > 0 {
+				tasks[i]["timeout"] = check.Timeout.String()
 			}
-			taskExpect := ""
-			if i < len(expects) {
-				taskExpect = expects[i]
+			if check.Shell != "" {
+				tasks[i]["shell"] = check.Shell
 			}
-
-			tasks[i] = map[string]interface{}{
-				"id":      fmt.Sprintf("task-%d", i+1),
-				"command": input,
-				"type":    taskType,
-				"name":    taskName,
-				"expect":  taskExpect,
+			addHTTPRequestFields(tasks[i], check.HTTP)
+			addTCPRequestFields(tasks[i], check.TCP)
+			if check.ExpectFail {
+				tasks[i]["expectFail"] = true
+			}
+			if len(check.ExpectStatus) > 0 {
+				tasks[i]["expectStatus"] = check.ExpectStatus.String()
+			}
+			if check.MaxLatency > 0 {
+				tasks[i]["maxLatency"] = check.MaxLatency.String()
+			}
+			if check.Until > 0 {
+				tasks[i]["until"] = check.Until.String()
+			}
+			if check.Interval > 0 {
+				tasks[i]["interval"] = check.Interval.String()
+			}
+			if retry := check.Retry; retry != nil {
+				tasks[i]["retries"] = retry.Retries
+				tasks[i]["retryDelay"] = retry.Delay.String()
+				tasks[i]["retryOn"] = strings.Join(retry.On, ",")
+			}
+			if len(check.Tags) > 0 {
+				tasks[i]["tags"] = check.Tags
+			}
+			if len(check.Labels) > 0 {
+				tasks[i]["labels"] = check.Labels
 			}
 		}
 
@@ -1131,6 +2612,39 @@ func (app *App) generateTasks() []map[string]interface{} {
 	return tasks
 }
 
+// addHTTPRequestFields copies the HTTP request settings into a task so
+// parseHTTPRequest can rebuild them on the worker
+func addHTTPRequestFields(task map[string]interface{}, req HTTPRequest) {
+	if req.Method != "" {
+		task["method"] = req.Method
+	}
+	if len(req.Headers) > 0 {
+		task["headers"] = req.Headers
+	}
+	if req.Body != "" {
+		task["body"] = req.Body
+	}
+	if len(req.Query) > 0 {
+		task["query"] = req.Query
+	}
+	if req.ContentType != "" {
+		task["contentType"] = req.ContentType
+	}
+}
+
+// addTCPRequestFields copies the tcp probe settings into a task
+func addTCPRequestFields(task map[string]interface{}, req TCPRequest) {
+	if req.Send != "" {
+		task["send"] = req.Send
+	}
+	if req.Read {
+		task["read"] = true
+	}
+	if req.Blocked {
+		task["blocked"] = true
+	}
+}
+
 // assignTaskToPod assigns a task to a specific pod
 func (app *App) assignTaskToPod(ctx context.Context, podName string, task map[string]interface{}) error {
 	// Create a ConfigMap to store the task
@@ -1226,7 +2740,7 @@ func (app *App) processAssignedTasks(ctx context.Context, podName string) error
 
 		// Process the task
 		app.logger.Infof("Processing task %s", task["id"])
-		if err := app.executeTask(task); err != nil {
+		if err := app.active().executeTask(task); err != nil {
 			app.logger.Errorf("Failed to execute task %s: %v", task["id"], err)
 		}
 
@@ -1261,14 +2775,16 @@ func (app *App) executeTask(task map[string]interface{}) error {
 
 	app.logger.Infof("Executing task %s: %s", taskID, command)
 
-	// Create a single-item slice for the existing execCmd method
-	inputs := []string{command}
-	types := []string{taskType}
-	names := []string{taskName}
-	expects := []string{taskExpect}
+	check := Check{
+		Input:        command,
+		Type:         taskType,
+		Name:         taskName,
+		Expect:       taskExpect,
+		InputOptions: app.parseInputOptions(task),
+	}
 
 	// Execute the task using existing logic
-	results := app.execCmd(inputs, types, names, expects)
+	results := app.execCmd([]Check{check})
 
 	// Log the result
 	for _, result := range results {
@@ -1278,19 +2794,48 @@ func (app *App) executeTask(task map[string]interface{}) error {
 	return nil
 }
 
-// mainExec is the main execution logic
-func mainExec(args Args) error {
-	config, err := loadConfig(args["c"].(string))
+// loadSettings validates and loads the config files, then applies the
+// environment and the command line flags over them. Settings resolve as
+// command line flag, then environment, then config file.
+func loadSettings(paths []string, args Args) (*Config, error) {
+	// Refuse a config with problems rather than run part of it
+	profile := configProfile(args)
+	vars, err := templateVars(args)
 	if err != nil {
-		return fmt.Errorf("failed to load config: %w", err)
+		return nil, err
+	}
+	if diagnostics := validateConfigFiles(paths, profile, vars); len(diagnostics) > 0 {
+		return nil, &ValidationError{Diagnostics: diagnostics}
 	}
 
-	// Override config with command line arguments
-	if webserver := args["w"].(bool); webserver {
-		config.WebServer.Enable = true
+	config, err := loadConfigFiles(paths, profile)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load config: %w", err)
 	}
-	if port := args["p"].(string); port != "" {
-		config.WebServer.Port = port
+	applyArgs(config, args)
+	return config, nil
+}
+
+// mainExec is the main execution logic
+func mainExec(args Args) error {
+	paths := configFiles(args)
+	config, err := loadSettings(paths, args)
+	if err != nil {
+		return err
+	}
+
+	// Without a subcommand the mode comes from -w and LEADER_ELECTION
+	command := args.String("command")
+	legacy := command == ""
+	if legacy {
+		switch {
+		case config.WebServer.Enable:
+			command = CommandServe
+		case os.Getenv("LEADER_ELECTION") == "true":
+			command = CommandAgent
+		default:
+			command = CommandRun
+		}
 	}
 
 	// Setup logging
@@ -1303,162 +2848,207 @@ func mainExec(args Args) error {
 	app := NewApp(config)
 	app.logger = logger
 
-	// Override config with command line arguments
-	if workerNum := args["worker"].(int); workerNum > 0 {
-		app.workerNum = workerNum
+	if app.exitPolicy, err = parseExitPolicy(config.Exit.FailOn, config.Exit.Threshold); err != nil {
+		return fmt.Errorf("invalid exit policy: %w", err)
 	}
-	if format := args["f"].(string); format != "" {
-		app.format = format
-	}
-	if base64 := args["e"].(string); base64 != "" {
-		app.base64 = base64
-	}
-
-	// Check if leader election is enabled (via environment variable)
-	app.leaderElection = os.Getenv("LEADER_ELECTION") == "true"
 	if namespace := os.Getenv("NAMESPACE"); namespace != "" {
 		app.namespace = namespace
 	}
+	if namespace := args.String("namespace"); namespace != "" {
+		app.namespace = namespace
+	}
 
 	// Set runtime configuration
 	numCPUs := runtime.NumCPU()
 	runtime.GOMAXPROCS(numCPUs)
 
+	app.logger.Debugf("Command: %s", command)
 	app.logger.Debugf("Worker number: %d", app.workerNum)
-	app.logger.Debugf("Web server enabled: %v", config.WebServer.Enable)
 	app.logger.Debugf("HTTP host: %s", config.WebServer.Host)
 	app.logger.Debugf("HTTP port: %s", config.WebServer.Port)
-	app.logger.Debugf("Leader election enabled: %v", app.leaderElection)
 	app.logger.Debugf("Namespace: %s", app.namespace)
 
-	// If leader election is enabled, set up Kubernetes client
-	if app.leaderElection {
+	selector, err := parseSelector(args.String("tags"), args.String("exclude-tags"), args.String("name-regex"))
+	if err != nil {
+		return fmt.Errorf("invalid selection: %w", err)
+	}
+	app.selector = selector
+	app.vars, _ = templateVars(args) // checked by loadSettings
+
+	if command == CommandAgent {
 		if err := app.createKubernetesClient(); err != nil {
+			if !legacy {
+				return fmt.Errorf("failed to create Kubernetes client: %w", err)
+			}
 			app.logger.Errorf("Failed to create Kubernetes client: %v", err)
 			app.logger.Info("Falling back to non-leader election mode")
-			app.leaderElection = false
+			command = CommandRun
 		}
 	}
 
-	// Run application
-	if config.WebServer.Enable {
+	// Run application; the long-running modes reload the config when it changes
+	reload := func() (*Config, error) { return loadSettings(paths, args) }
+	switch command {
+	case CommandServe:
+		app.watchConfig(paths, reload)
 		app.webserver()
-	} else if app.leaderElection {
-		// Run with leader election
-		ctx, cancel := context.WithCancel(context.Background())
-		defer cancel()
-
-		// Handle shutdown signals
-		sigCh := make(chan os.Signal, 1)
-		signal.Notify(sigCh, os.Interrupt, syscall.SIGTERM)
-		go func() {
-			<-sigCh
-			app.logger.Info("Received shutdown signal, cancelling context")
-			cancel()
-		}()
-
-		return app.runLeaderElection(ctx)
+		return nil
+	case CommandAgent:
+		app.leaderElection = true
+		app.watchConfig(paths, reload)
+		return app.runAgent()
+	}
+
+	// run, wait and validate work on command line input or config file input
+	var checks []Check
+
+	cli := CLIInputs{
+		List:    args.String("i"),
+		Inputs:  args.Strings("input"),
+		Expects: args.Strings("expect"),
+		Names:   args.Strings("name"),
+		Types:   args.Strings("type"),
+		Type:    args.String("t"),
+		Name:    args.String("n"),
+	}
+	if cli.List != "" || len(cli.Inputs) > 0 {
+		// Command line input takes precedence
+		checks, err = app.parseCLIInputs(cli, os.Stdin)
+		var validationErr *ValidationError
+		if errors.As(err, &validationErr) {
+			return err
+		} else if err != nil {
+			return fmt.Errorf("invalid input: %w", err)
+		}
 	} else {
-		// Handle command line input or config file input
-		var inputs []string
-		var types []string
-		var names []string
-
-		if input := args["i"].(string); input != "" {
-			// Command line input takes precedence
-			inputs = strings.Split(input, ",")
-			for i, inp := range inputs {
-				inputs[i] = strings.TrimSpace(inp)
-			}
-
-			// Determine request types
-			requestType := args["t"].(string)
-			types = make([]string, len(inputs))
-			for i := range inputs {
-				if strings.HasPrefix(inputs[i], "http://") || strings.HasPrefix(inputs[i], "https://") {
-					types[i] = requestType
-				} else {
-					types[i] = RequestTypeCmd
-				}
-			}
+		// Parse config file input
+		checks = app.configInputs()
+	}
+	if diagnostics := checkDependencies(checks); len(diagnostics) > 0 {
+		return &ValidationError{Diagnostics: diagnostics}
+	}
+	if !selector.Empty() {
+		total := len(checks)
+		checks = selector.Select(checks)
+		app.logger.Debugf("Selected %d of %d inputs by %s", len(checks), total, selector)
+		if len(checks) == 0 {
+			return fmt.Errorf("no inputs match %s", selector)
+		}
+	}
 
-			// Set names
-			names = make([]string, len(inputs))
-			if name := args["n"].(string); name != "" {
-				for i := range names {
-					names[i] = name
-				}
+	switch command {
+	case CommandValidate:
+		return app.validateInputs(checks, os.Stdout)
+	case CommandWait:
+		deadline, interval := DefaultWaitDeadline, DefaultWaitInterval
+		if v := args.String("deadline"); v != "" {
+			if deadline, err = parseTimeout(v); err != nil {
+				return fmt.Errorf("invalid deadline: %w", err)
 			}
-		} else if config.Request.Input != "" {
-			// Parse config file input
-			inputs, types, names, expects := app.parseConfigInput(config.Request.Input)
-			if len(inputs) > 0 {
-				app.makeResponse(inputs, types, names, expects)
+		}
+		if v := args.String("interval"); v != "" {
+			if interval, err = parseTimeout(v); err != nil {
+				return fmt.Errorf("invalid interval: %w", err)
 			}
 		}
+		return app.waitFor(checks, deadline, interval)
+	}
+
+	if len(checks) == 0 {
+		if legacy {
+			return nil
+		}
+		return fmt.Errorf("no inputs: pass -i/--input or a config file with request.inputs")
 	}
+	return app.runAndReport(checks, app.exitPolicy, os.Stderr)
+}
+
+// runAgent runs leader election until a shutdown signal arrives
+func (app *App) runAgent() error {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	// Handle shutdown signals
+	sigCh := make(chan os.Signal, 1)
+	signal.Notify(sigCh, os.Interrupt, syscall.SIGTERM)
+	go func() {
+		<-sigCh
+		app.logger.Info("Received shutdown signal, cancelling context")
+		cancel()
+	}()
+
+	return app.runLeaderElection(ctx)
+}
 
+// validateInputs reports the inputs that passed validation. The config file
+// and command line inputs were already checked while loading them.
+func (app *App) validateInputs(checks []Check, out io.Writer) error {
+	if len(checks) == 0 {
+		return fmt.Errorf("no inputs: pass -i/--input or a config file with request.inputs")
+	}
+	fmt.Fprintf(out, "OK: %d inputs\n", len(checks))
 	return nil
 }
 
-func main() {
-	if len(os.Args) < 2 {
-		fmt.Println("Usage: mcall <command> [options]")
-		fmt.Println("Commands:")
-		fmt.Println("  -i      - Execute command or HTTP request")
-		fmt.Printf("  -t      - Request type (get, post, cmd) default: %s\n", RequestTypeCmd)
-		fmt.Println("  -w      - Run webserver")
-		fmt.Println("  -c      - Configuration file path")
-		fmt.Println("  -help   - Show help")
-		fmt.Println("")
-		fmt.Println("Examples:")
-		fmt.Println("  mcall -i=\"ls /etc/hosts\"")
-		fmt.Printf("  mcall -t=%s -i=\"http://localhost:%s/healthcheck\"\n", RequestTypeGet, DefaultHTTPPort)
-		fmt.Printf("  mcall -t=%s -i=\"http://localhost:8000/uptime_list?company_id=1\"\n", RequestTypePost)
-		fmt.Println("  mcall -w=true")
-		fmt.Println("  mcall -c=/etc/mcall/mcall.yaml")
-		return
+// waitFor polls every input until it passes or the deadline expires. Inputs
+// with their own until/interval keep them. It returns an error listing the
+// inputs that were still failing when it gave up; the exit policy does not
+// apply, since waiting is only done once every input is healthy.
+func (app *App) waitFor(checks []Check, deadline, interval time.Duration) error {
+	if len(checks) == 0 {
+		return fmt.Errorf("nothing to wait for: no inputs given")
 	}
 
-	// Parse command line flags
-	var (
-		help    = flag.Bool("help", false, "Show these options")
-		vt      = flag.String("t", RequestTypeCmd, "Request type (get, post, cmd)")
-		vi      = flag.String("i", "", "Input (command or URL, multiple separated by comma)")
-		vc      = flag.String("c", "", "Configuration file path")
-		vw      = flag.Bool("w", false, "Run webserver")
-		vp      = flag.String("p", DefaultHTTPPort, "Webserver port")
-		vf      = flag.String("f", DefaultFormat, "Return format (json, plain)")
-		ve      = flag.String("e", "", "Return result with encoding (std, url)")
-		vn      = flag.String("n", "", "Request name")
-		vworker = flag.Int("worker", DefaultWorkerNum, "Number of workers")
-		vlf     = flag.String("lf", DefaultLogFile, "Logfile destination")
-		vll     = flag.String("l", DefaultLogLevel, "Log level (debug, info, error)")
-	)
-	flag.Parse()
-
-	args := Args{
-		"help":     *help,
-		"t":        *vt,
-		"i":        *vi,
-		"c":        *vc,
-		"w":        *vw,
-		"p":        *vp,
-		"f":        *vf,
-		"e":        *ve,
-		"n":        *vn,
-		"worker":   *vworker,
-		"logfile":  *vlf,
-		"loglevel": *vll,
-	}
-
-	if args["help"] == true {
-		flag.PrintDefaults()
-		return
+	waitChecks := make([]Check, len(checks))
+	copy(waitChecks, checks)
+	for i := range waitChecks {
+		if waitChecks[i].Until == 0 {
+			waitChecks[i].Until = deadline
+		}
+		if waitChecks[i].Interval == 0 {
+			waitChecks[i].Interval = interval
+		}
+	}
+
+	return app.runAndReport(waitChecks, ExitPolicy{FailOn: FailOnAny}, os.Stderr)
+}
+
+// runAndReport executes the inputs, prints the results, writes a summary line
+// to summary and returns a *CheckFailure when policy is violated
+func (app *App) runAndReport(checks []Check, policy ExitPolicy, summary io.Writer) error {
+	fetched := app.runChecks(checks)
+	formatted := make([]map[string]interface{}, 0, len(fetched))
+	var failed, skipped []FetchedResult
+	for _, result := range fetched {
+		formatted = append(formatted, app.formatResult(result))
+		switch {
+		case result.Skipped:
+			skipped = append(skipped, result)
+		case result.Error != ErrorCodeSuccess:
+			failed = append(failed, result)
+		}
+	}
+	app.writeResponse(formatted)
+
+	// Skipped checks did not run, so they count neither as passed nor failed
+	ran := len(fetched) - len(skipped)
+	skippedNote := ""
+	if len(skipped) > 0 {
+		skippedNote = fmt.Sprintf("; %d skipped: %s", len(skipped), resultLabels(skipped))
+	}
+	if len(failed) == 0 {
+		fmt.Fprintf(summary, "mcall: %d of %d checks passed%s\n", ran, ran, skippedNote)
+		return nil
 	}
 
-	if err := mainExec(args); err != nil {
-		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
-		os.Exit(1)
+	fmt.Fprintf(summary, "mcall: %d of %d checks failed (fail-on %s): %s%s\n", len(failed), ran, policy, resultLabels(failed), skippedNote)
+
+	if policy.Fails(len(failed), ran) {
+		return &CheckFailure{Failed: failed, Total: ran, Policy: policy}
 	}
+	return nil
+}
+
+func main() {
+	os.Exit(runCLI(os.Args[1:], os.Stdout, os.Stderr))
 }
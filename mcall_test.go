@@ -1,12 +1,20 @@
 package main
 
 import (
+	"encoding/json"
+	"errors"
 	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
 	"os"
 	"strings"
+	"sync/atomic"
 	"testing"
 	"time"
 
+	"github.com/op/go-logging"
 	"github.com/stretchr/testify/assert"
 )
 
@@ -32,6 +40,17 @@ func setupTestEnvironment() {
 	os.Setenv("MCALL_WORKER_NUM", "2")
 }
 
+// splitChecks lists the input, type, name and expect of every check
+func splitChecks(checks []Check) (inputs, types, names, expects []string) {
+	for _, check := range checks {
+		inputs = append(inputs, check.Input)
+		types = append(types, check.Type)
+		names = append(names, check.Name)
+		expects = append(expects, check.Expect)
+	}
+	return inputs, types, names, expects
+}
+
 // cleanupTestEnvironment cleans up test environment
 func cleanupTestEnvironment() {
 	// Clean up any test artifacts
@@ -133,9 +152,8 @@ func testMainExec(args Args) error {
 			}
 		} else if config.Request.Input != "" {
 			// Parse config file input
-			inputs, types, names, expects := app.parseConfigInput(config.Request.Input)
-			if len(inputs) > 0 {
-				app.makeResponse(inputs, types, names, expects)
+			if checks := app.configInputs(); len(checks) > 0 {
+				app.makeResponse(checks)
 			}
 		}
 	}
@@ -225,29 +243,11 @@ func TestPipeline(t *testing.T) {
 	pipeline.Stop()
 }
 
-// TestFetchedInput tests the FetchedInput functionality
-func TestFetchedInput(t *testing.T) {
-	fi := NewFetchedInput()
-	assert.NotNil(t, fi)
-
-	// Test initial state
-	assert.False(t, fi.IsProcessed("test-input"))
-
-	// Test marking as processed
-	fi.MarkProcessed("test-input", nil)
-	assert.True(t, fi.IsProcessed("test-input"))
-
-	// Test with error
-	fi.MarkProcessed("test-input-error", assert.AnError)
-	assert.True(t, fi.IsProcessed("test-input-error"))
-}
-
 // TestCallFetch tests the CallFetch functionality
 func TestCallFetch(t *testing.T) {
-	fetchedInput := NewFetchedInput()
 	pipeline := NewPipeline()
 
-	cf := NewCallFetch(fetchedInput, pipeline, "echo hello", RequestTypeCmd, "test", "")
+	cf := NewCallFetch(pipeline, "echo hello", RequestTypeCmd, "test", "")
 	assert.NotNil(t, cf)
 
 	// Test CallFetch creation
@@ -290,6 +290,950 @@ func TestErrorCodes(t *testing.T) {
 	assert.NotEqual(t, ErrorCodeSuccess, ErrorCodeFailure)
 }
 
+// TestExecCmdConcurrency tests that inputs are fanned out to the worker pool
+func TestExecCmdConcurrency(t *testing.T) {
+	app := NewApp(&Config{})
+	app.logger = logging.MustGetLogger("mcall")
+	app.workerNum = 3
+
+	checks := []Check{
+		{Input: "sleep 1", Type: RequestTypeCmd, Name: "first"},
+		{Input: "echo second", Type: RequestTypeCmd, Name: "second"},
+		{Input: "sleep 0.5", Type: RequestTypeCmd, Name: "third"},
+	}
+
+	start := time.Now()
+	results := app.execCmd(checks)
+	elapsed := time.Since(start)
+
+	// Three workers run the sleeps side by side instead of one after another
+	assert.Less(t, elapsed, 1400*time.Millisecond)
+
+	// Default order follows the inputs
+	assert.Len(t, results, 3)
+	for i, result := range results {
+		assert.Equal(t, checks[i].Input, result["input"])
+		assert.Equal(t, checks[i].Name, result["name"])
+	}
+
+	// Completion order reports the fastest input first
+	app.order = ResultOrderCompletion
+	results = app.execCmd(checks)
+	assert.Len(t, results, 3)
+	assert.Equal(t, "second", results[0]["name"])
+	assert.Equal(t, "first", results[2]["name"])
+}
+
+// TestExecCmdDuplicateInputs tests that identical inputs each run and are
+// checked against their own expect, whether they run one after another or at
+// the same time
+func TestExecCmdDuplicateInputs(t *testing.T) {
+	app := NewApp(&Config{})
+	app.logger = logging.MustGetLogger("mcall")
+
+	for _, workers := range []int{1, 2} {
+		app.workerNum = workers
+		results := app.execCmd([]Check{
+			{Input: "echo dup", Type: RequestTypeCmd, Name: "plain"},
+			{Input: "echo dup", Type: RequestTypeCmd, Name: "matches", Expect: "dup"},
+			{Input: "echo dup", Type: RequestTypeCmd, Name: "mismatch", Expect: "other"},
+		})
+		assert.Len(t, results, 3)
+		for _, result := range results {
+			assert.Equal(t, "dup\n", result["result"], "%s with %d workers", result["name"], workers)
+		}
+		assert.Equal(t, ErrorCodeSuccess, results[0]["errorCode"])
+		assert.Equal(t, ErrorCodeSuccess, results[1]["errorCode"])
+		assert.Equal(t, ErrorCodeExpect, results[2]["errorCode"], "with %d workers", workers)
+	}
+}
+
+// TestCallFetchTimeout tests that the per-input timeout is applied and reported
+func TestCallFetchTimeout(t *testing.T) {
+	cf := NewCallFetch(NewPipeline(), "sleep 5", RequestTypeCmd, "slow", "")
+	cf.timeout = 200 * time.Millisecond
+
+	start := time.Now()
+	err := cf.Execute()
+	assert.Less(t, time.Since(start), 2*time.Second)
+	assert.ErrorIs(t, err, ErrTimeout)
+
+	result := <-cf.result
+	assert.True(t, result.TimedOut)
+	assert.Equal(t, 200*time.Millisecond, result.Timeout)
+	assert.Equal(t, ErrorCodeTimeout, result.Error)
+}
+
+// TestParseTimeout tests the accepted per-input timeout formats
+func TestParseTimeout(t *testing.T) {
+	tests := []struct {
+		value    interface{}
+		expected time.Duration
+		wantErr  bool
+	}{
+		{value: float64(3), expected: 3 * time.Second},
+		{value: 1.5, expected: 1500 * time.Millisecond},
+		{value: 5, expected: 5 * time.Second},
+		{value: "2", expected: 2 * time.Second},
+		{value: "500ms", expected: 500 * time.Millisecond},
+		{value: "soon", wantErr: true},
+		{value: true, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(fmt.Sprintf("%v", tt.value), func(t *testing.T) {
+			d, err := parseTimeout(tt.value)
+			if tt.wantErr {
+				assert.Error(t, err)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, tt.expected, d)
+		})
+	}
+}
+
+// TestParseInputParamsWithTimeout tests that per-input timeouts are parsed
+func TestParseInputParamsWithTimeout(t *testing.T) {
+	app := NewApp(&Config{})
+
+	checks := app.parseInputParams(`{"inputs":[{"input":"echo a","timeout":2},{"input":"echo b"}]}`)
+	assert.Len(t, checks, 2)
+	assert.Equal(t, "echo a", checks[0].Input)
+	assert.Equal(t, "echo b", checks[1].Input)
+	assert.Equal(t, InputOptions{Timeout: 2 * time.Second}, checks[0].InputOptions)
+	assert.Equal(t, InputOptions{}, checks[1].InputOptions)
+}
+
+// TestSplitArgs tests POSIX-style argv parsing for non-shell commands
+func TestSplitArgs(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected []string
+		wantErr  bool
+	}{
+		{input: "ls -la", expected: []string{"ls", "-la"}},
+		{input: "  echo   hello  ", expected: []string{"echo", "hello"}},
+		{input: "echo 'hello world'", expected: []string{"echo", "hello world"}},
+		{input: `curl -H "Content-Type: application/json" http://x`, expected: []string{"curl", "-H", "Content-Type: application/json", "http://x"}},
+		{input: `echo "say \"hi\""`, expected: []string{"echo", `say "hi"`}},
+		{input: `echo "a\b"`, expected: []string{"echo", `a\b`}},
+		{input: `echo hello\ world`, expected: []string{"echo", "hello world"}},
+		{input: `echo '' x`, expected: []string{"echo", "", "x"}},
+		{input: `echo 'unterminated`, wantErr: true},
+		{input: `echo trailing\`, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.input, func(t *testing.T) {
+			args, err := splitArgs(tt.input)
+			if tt.wantErr {
+				assert.Error(t, err)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, tt.expected, args)
+		})
+	}
+}
+
+// TestShellExecution tests running cmd inputs through a shell interpreter
+func TestShellExecution(t *testing.T) {
+	out, err := exeCmd("echo one two | wc -w", DefaultShell, DefaultTimeoutDuration)
+	assert.NoError(t, err)
+	assert.Equal(t, "2", strings.TrimSpace(out.Raw))
+
+	// Without a shell the pipe is passed to echo as a literal argument
+	out, err = exeCmd("echo one | wc -w", "", DefaultTimeoutDuration)
+	assert.NoError(t, err)
+	assert.Equal(t, "one | wc -w", strings.TrimSpace(out.Raw))
+
+	// A timeout kills the whole pipeline, not just the shell
+	start := time.Now()
+	_, err = exeCmd("sleep 5 | cat", DefaultShell, 200*time.Millisecond)
+	assert.ErrorIs(t, err, ErrTimeout)
+	assert.Less(t, time.Since(start), 2*time.Second)
+}
+
+// TestParseInputOptionsShell tests the shell option forms
+func TestParseInputOptionsShell(t *testing.T) {
+	app := NewApp(&Config{})
+
+	assert.Equal(t, DefaultShell, app.parseInputOptions(map[string]interface{}{"shell": true}).Shell)
+	assert.Equal(t, "/bin/bash", app.parseInputOptions(map[string]interface{}{"shell": "/bin/bash"}).Shell)
+	assert.Equal(t, "", app.parseInputOptions(map[string]interface{}{"shell": false}).Shell)
+
+	app.logger = logging.MustGetLogger("mcall")
+	results := app.execCmd([]Check{{Input: "echo $((1 + 2))", Type: RequestTypeShell, Name: "sh"}})
+	assert.Equal(t, "3", strings.TrimSpace(results[0]["result"].(string)))
+}
+
+// TestExeCmdResultDetails tests exit code and separate stdout/stderr capture
+func TestExeCmdResultDetails(t *testing.T) {
+	doc, err := exeCmd("echo out; echo err >&2; exit 3", DefaultShell, DefaultTimeoutDuration)
+	assert.Error(t, err)
+	assert.Equal(t, 3, doc.ExitCode)
+	assert.Equal(t, "out\n", doc.Stdout)
+	assert.Equal(t, "err\n", doc.Stderr)
+	assert.Contains(t, doc.Raw, "out")
+	assert.Contains(t, doc.Raw, "err")
+
+	doc, err = exeCmd("invalid_command_that_does_not_exist", "", DefaultTimeoutDuration)
+	assert.Error(t, err)
+	assert.Equal(t, -1, doc.ExitCode)
+}
+
+// TestFetchHTTPResultDetails tests status code, headers and final URL capture
+func TestFetchHTTPResultDetails(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/old" {
+			http.Redirect(w, r, "/new", http.StatusFound)
+			return
+		}
+		w.Header().Set("X-Test", "yes")
+		w.WriteHeader(http.StatusAccepted)
+		fmt.Fprint(w, "moved")
+	}))
+	defer server.Close()
+
+	doc, err := fetchHTTP(server.URL+"/old", HTTPRequest{Method: HTTPMethodGet}, DefaultTimeoutDuration)
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusAccepted, doc.StatusCode)
+	assert.Equal(t, "yes", doc.Headers.Get("X-Test"))
+	assert.Equal(t, server.URL+"/new", doc.URL)
+	assert.Equal(t, "moved", doc.Raw)
+}
+
+// TestFormatResultFields tests the structured fields emitted in JSON results
+func TestFormatResultFields(t *testing.T) {
+	app := NewApp(&Config{})
+	app.logger = logging.MustGetLogger("mcall")
+
+	results := app.execCmd([]Check{{Input: "echo hi; echo oops >&2; exit 2", Type: RequestTypeShell, Name: "details"}})
+	result := results[0]
+
+	// Existing keys are kept for backward compatibility
+	assert.Equal(t, "details", result["name"])
+	assert.Equal(t, ErrorCodeCommand, result["errorCode"])
+	assert.Contains(t, result["result"], "hi")
+	assert.NotEmpty(t, result["ts"])
+
+	assert.Equal(t, 2, result["exitCode"])
+	assert.Equal(t, "hi\n", result["stdout"])
+	assert.Equal(t, "oops\n", result["stderr"])
+	assert.Contains(t, result["error"], "exit status 2")
+	assert.IsType(t, int64(0), result["durationMs"])
+	assert.NotContains(t, result, "statusCode")
+}
+
+// TestErrorCodeTaxonomy tests that failures map onto distinct error codes
+func TestErrorCodeTaxonomy(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, "unexpected body")
+	}))
+	defer server.Close()
+
+	tlsServer := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, "secure")
+	}))
+	defer tlsServer.Close()
+
+	// Reserve a local port and close it so connecting is refused
+	closed := httptest.NewServer(http.NotFoundHandler())
+	closedURL := closed.URL
+	closed.Close()
+
+	tests := []struct {
+		name     string
+		input    string
+		sType    string
+		expect   string
+		expected string
+	}{
+		{name: "success", input: "echo ok", sType: RequestTypeCmd, expected: ErrorCodeSuccess},
+		{name: "command failed", input: "false", sType: RequestTypeCmd, expected: ErrorCodeCommand},
+		{name: "command not found", input: "invalid_command_that_does_not_exist", sType: RequestTypeCmd, expected: ErrorCodeCommand},
+		{name: "http request failed", input: "http://[::1]:namedport", sType: RequestTypeGet, expected: ErrorCodeHTTP},
+		{name: "expect failed", input: server.URL, sType: RequestTypeGet, expect: "healthy", expected: ErrorCodeExpect},
+		{name: "dns failure", input: "http://host.invalid/", sType: RequestTypeGet, expected: ErrorCodeDNS},
+		{name: "connection refused", input: closedURL, sType: RequestTypeGet, expected: ErrorCodeConnRefused},
+		{name: "tls failure", input: tlsServer.URL, sType: RequestTypeGet, expected: ErrorCodeTLS},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cf := NewCallFetch(NewPipeline(), tt.input, tt.sType, tt.name, tt.expect)
+			cf.Execute()
+			result := <-cf.result
+			assert.Equal(t, tt.expected, result.Error, result.ErrorMessage)
+		})
+	}
+}
+
+// TestHTTPRequestSpec tests method, headers, body, query and contentType per input
+func TestHTTPRequestSpec(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		fmt.Fprintf(w, "%s %s?%s token=%s type=%s body=%s",
+			r.Method, r.URL.Path, r.URL.RawQuery, r.Header.Get("X-Token"), r.Header.Get("Content-Type"), body)
+	}))
+	defer server.Close()
+
+	app := NewApp(&Config{})
+	app.logger = logging.MustGetLogger("mcall")
+
+	params := fmt.Sprintf(`{"inputs":[
+		{"input":"%[1]s/items?a=1","type":"http","method":"put","headers":{"X-Token":"secret"},"body":{"name":"x"},"query":{"b":["2","3"]}},
+		{"input":"%[1]s/raw","type":"post","body":"k=v","contentType":"application/x-www-form-urlencoded"},
+		{"input":"%[1]s/gone","type":"delete"},
+		{"input":"%[1]s/plain","type":"get"},
+		{"input":"%[1]s/api","type":"post","headers":{"content-type":"application/vnd.api+json"},"body":{"data":1}}
+	]}`, server.URL)
+
+	results := app.execCmd(app.parseInputParams(params))
+
+	assert.Equal(t, `PUT /items?a=1&b=2&b=3 token=secret type=application/json body={"name":"x"}`, results[0]["result"])
+	assert.Equal(t, "POST /raw? token= type=application/x-www-form-urlencoded body=k=v", results[1]["result"])
+	assert.Equal(t, "DELETE /gone? token= type= body=", results[2]["result"])
+	assert.Equal(t, "GET /plain? token= type= body=", results[3]["result"])
+	assert.Equal(t, `POST /api? token= type=application/vnd.api+json body={"data":1}`, results[4]["result"], "a Content-Type header wins over the JSON default")
+}
+
+// TestTCPProbe tests the tcp request type including payloads and blocked checks
+func TestTCPProbe(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.NoError(t, err)
+	defer listener.Close()
+
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			go func(conn net.Conn) {
+				defer conn.Close()
+				buf := make([]byte, 64)
+				n, _ := conn.Read(buf)
+				if strings.HasPrefix(string(buf[:n]), "PING") {
+					io.WriteString(conn, "+PONG\r\n")
+				}
+			}(conn)
+		}
+	}()
+	open := listener.Addr().String()
+
+	// Reserve a port and close it so connecting is refused
+	closedListener, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.NoError(t, err)
+	closed := closedListener.Addr().String()
+	closedListener.Close()
+
+	tests := []struct {
+		name     string
+		input    string
+		tcp      TCPRequest
+		expect   string
+		expected string
+		content  string
+	}{
+		{name: "connect", input: open, expected: ErrorCodeSuccess, content: "connected to " + open},
+		{name: "scheme prefix", input: "tcp://" + open, expected: ErrorCodeSuccess},
+		{name: "send and read", input: open, tcp: TCPRequest{Send: "PING\r\n"}, expect: "PONG", expected: ErrorCodeSuccess, content: "+PONG\r\n"},
+		{name: "refused", input: closed, expected: ErrorCodeConnRefused},
+		{name: "invalid address", input: "localhost", expected: ErrorCodeTCP},
+		{name: "blocked and refused", input: closed, tcp: TCPRequest{Blocked: true}, expected: ErrorCodeSuccess},
+		{name: "blocked but reachable", input: open, tcp: TCPRequest{Blocked: true}, expected: ErrorCodeExpect},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cf := NewCallFetch(NewPipeline(), tt.input, RequestTypeTCP, tt.name, tt.expect)
+			cf.tcp = tt.tcp
+			cf.timeout = time.Second
+			cf.Execute()
+			result := <-cf.result
+			assert.Equal(t, tt.expected, result.Error, result.ErrorMessage)
+			assert.Equal(t, tt.tcp.Blocked, result.Negated)
+			if tt.content != "" {
+				assert.Equal(t, tt.content, result.Content)
+			}
+		})
+	}
+}
+
+// TestNegativeAssertions tests expectFail/negate and !pattern expects
+func TestNegativeAssertions(t *testing.T) {
+	tests := []struct {
+		name       string
+		input      string
+		expect     string
+		expectFail bool
+		expected   string
+	}{
+		{name: "not pattern passes", input: "echo hello", expect: "!error", expected: ErrorCodeSuccess},
+		{name: "not pattern fails", input: "echo error", expect: "!error", expected: ErrorCodeExpect},
+		{name: "not pattern in alternatives", input: "echo error", expect: "ok|!fatal", expected: ErrorCodeSuccess},
+		{name: "expectFail on failed command", input: "false", expectFail: true, expected: ErrorCodeSuccess},
+		{name: "expectFail on unmatched body", input: "echo denied", expect: "welcome", expectFail: true, expected: ErrorCodeSuccess},
+		{name: "expectFail on success", input: "echo welcome", expect: "welcome", expectFail: true, expected: ErrorCodeExpect},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cf := NewCallFetch(NewPipeline(), tt.input, RequestTypeCmd, tt.name, tt.expect)
+			cf.expectFail = tt.expectFail
+			cf.Execute()
+			result := <-cf.result
+			assert.Equal(t, tt.expected, result.Error, result.ErrorMessage)
+			assert.Equal(t, tt.expectFail, result.Negated)
+		})
+	}
+
+	app := NewApp(&Config{})
+	assert.True(t, app.parseInputOptions(map[string]interface{}{"expectFail": true}).ExpectFail)
+	assert.True(t, app.parseInputOptions(map[string]interface{}{"negate": true}).ExpectFail)
+	assert.False(t, app.parseInputOptions(map[string]interface{}{}).ExpectFail)
+}
+
+// TestParseExpectStatus tests status code lists, classes and ranges
+func TestParseExpectStatus(t *testing.T) {
+	tests := []struct {
+		value     interface{}
+		expected  string
+		match     []int
+		miss      []int
+		redirects bool
+	}{
+		{value: float64(200), expected: "200", match: []int{200}, miss: []int{201}},
+		{value: "2xx", expected: "2xx", match: []int{200, 204, 299}, miss: []int{301, 500}},
+		{value: "200|301|302", expected: "200,301,302", match: []int{301, 302}, miss: []int{304}, redirects: true},
+		{value: "200-204, 3XX", expected: "200-204,3xx", match: []int{204, 399}, miss: []int{205}, redirects: true},
+		{value: []interface{}{float64(200), "4xx"}, expected: "200,4xx", match: []int{404}, miss: []int{500}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.expected, func(t *testing.T) {
+			ranges, err := parseExpectStatus(tt.value)
+			assert.NoError(t, err)
+			assert.Equal(t, tt.expected, ranges.String())
+			assert.Equal(t, tt.redirects, ranges.Redirects())
+			for _, status := range tt.match {
+				assert.True(t, ranges.Match(status), "%d should match", status)
+			}
+			for _, status := range tt.miss {
+				assert.False(t, ranges.Match(status), "%d should not match", status)
+			}
+		})
+	}
+
+	for _, invalid := range []interface{}{"", "9xx", "abc", "299-200", "200-700", true} {
+		_, err := parseExpectStatus(invalid)
+		assert.Error(t, err, "%v should be rejected", invalid)
+	}
+}
+
+// TestExpectStatusAndLatency tests expectStatus and maxLatency against a live server
+func TestExpectStatusAndLatency(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/slow" {
+			time.Sleep(100 * time.Millisecond)
+		}
+		if r.URL.Path == "/missing" {
+			w.WriteHeader(http.StatusNotFound)
+		}
+		if r.URL.Path == "/login" {
+			http.Redirect(w, r, "/", http.StatusFound)
+			return
+		}
+		// The body mentions 200 so a substring expect would pass by accident
+		fmt.Fprint(w, "<html>status 200</html>")
+	}))
+	defer server.Close()
+
+	tests := []struct {
+		name         string
+		path         string
+		expectStatus string
+		maxLatency   time.Duration
+		expected     string
+	}{
+		{name: "status in class", path: "/", expectStatus: "2xx", expected: ErrorCodeSuccess},
+		{name: "status not listed", path: "/missing", expectStatus: "200|301|302", expected: ErrorCodeExpect},
+		{name: "status listed", path: "/missing", expectStatus: "404", expected: ErrorCodeSuccess},
+		{name: "redirect expected", path: "/login", expectStatus: "302", expected: ErrorCodeSuccess},
+		{name: "redirect followed", path: "/login", expectStatus: "200", expected: ErrorCodeSuccess},
+		{name: "redirect not followed", path: "/login", expectStatus: "200,301", expected: ErrorCodeExpect},
+		{name: "fast enough", path: "/", maxLatency: time.Second, expected: ErrorCodeSuccess},
+		{name: "too slow", path: "/slow", maxLatency: 20 * time.Millisecond, expected: ErrorCodeExpect},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cf := NewCallFetch(NewPipeline(), server.URL+tt.path, RequestTypeGet, tt.name, "")
+			if tt.expectStatus != "" {
+				ranges, err := parseExpectStatus(tt.expectStatus)
+				assert.NoError(t, err)
+				cf.expectStatus = ranges
+			}
+			cf.maxLatency = tt.maxLatency
+			cf.Execute()
+			result := <-cf.result
+			assert.Equal(t, tt.expected, result.Error, result.ErrorMessage)
+		})
+	}
+
+	app := NewApp(&Config{})
+	app.logger = logging.MustGetLogger("mcall")
+	opts := app.parseInputOptions(map[string]interface{}{"expectStatus": []interface{}{float64(200), "3xx"}, "maxLatency": float64(250)})
+	assert.Equal(t, "200,3xx", opts.ExpectStatus.String())
+	assert.Equal(t, 250*time.Millisecond, opts.MaxLatency)
+	opts = app.parseInputOptions(map[string]interface{}{"maxLatency": "1.5s"})
+	assert.Equal(t, 1500*time.Millisecond, opts.MaxLatency)
+}
+
+// TestRetryPolicy tests retries with backoff until a flaky server recovers
+func TestRetryPolicy(t *testing.T) {
+	var calls int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if atomic.AddInt32(&calls, 1) < 3 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+		}
+		fmt.Fprint(w, "ok")
+	}))
+	defer server.Close()
+
+	cf := NewCallFetch(NewPipeline(), server.URL, RequestTypeGet, "flaky", "")
+	cf.expectStatus = StatusRanges{{Min: 200, Max: 299}}
+	cf.retry = RetryPolicy{Retries: 3, Delay: time.Millisecond}
+	cf.Execute()
+	result := <-cf.result
+	assert.Equal(t, ErrorCodeSuccess, result.Error, result.ErrorMessage)
+	assert.Equal(t, 3, result.Attempts)
+	assert.Len(t, result.AttemptErrs, 2)
+	assert.Contains(t, result.AttemptErrs[0], "503")
+
+	// Retries run out and every attempt's error is kept
+	atomic.StoreInt32(&calls, -10)
+	cf = NewCallFetch(NewPipeline(), server.URL, RequestTypeGet, "down", "")
+	cf.expectStatus = StatusRanges{{Min: 200, Max: 299}}
+	cf.retry = RetryPolicy{Retries: 1, Delay: time.Millisecond}
+	cf.Execute()
+	result = <-cf.result
+	assert.Equal(t, ErrorCodeExpect, result.Error)
+	assert.Equal(t, 2, result.Attempts)
+	assert.Len(t, result.AttemptErrs, 2)
+
+	// Expect failures are only retried when asked for
+	cf = NewCallFetch(NewPipeline(), "echo nope", RequestTypeCmd, "expect", "yes")
+	cf.retry = RetryPolicy{Retries: 2, Delay: time.Millisecond}
+	cf.Execute()
+	result = <-cf.result
+	assert.Equal(t, 1, result.Attempts)
+
+	cf = NewCallFetch(NewPipeline(), "echo nope", RequestTypeCmd, "expect", "yes")
+	cf.retry = RetryPolicy{Retries: 2, Delay: time.Millisecond, On: []string{RetryOnExpect}}
+	cf.Execute()
+	result = <-cf.result
+	assert.Equal(t, 3, result.Attempts)
+	// A 5xx response is retried without expectStatus
+	atomic.StoreInt32(&calls, 1)
+	cf = NewCallFetch(NewPipeline(), server.URL, RequestTypeGet, "plain", "")
+	cf.retry = RetryPolicy{Retries: 3, Delay: time.Millisecond}
+	cf.Execute()
+	result = <-cf.result
+	assert.Equal(t, ErrorCodeSuccess, result.Error, result.ErrorMessage)
+	assert.Equal(t, 2, result.Attempts)
+	assert.Equal(t, []string{"status 503"}, result.AttemptErrs)
+}
+
+// TestRetryConditions tests which failures each retryOn condition matches
+func TestRetryConditions(t *testing.T) {
+	timeout := &FetchError{Code: ErrorCodeTimeout, Err: ErrTimeout}
+	refused := &FetchError{Code: ErrorCodeConnRefused, Err: errors.New("refused")}
+	expect := &FetchError{Code: ErrorCodeExpect, Err: errors.New("expect")}
+	command := &FetchError{Code: ErrorCodeCommand, Err: errors.New("exit 1")}
+
+	defaults := RetryPolicy{Retries: 1}
+	assert.True(t, defaults.shouldRetry(ResultDoc{}, timeout))
+	assert.True(t, defaults.shouldRetry(ResultDoc{}, refused))
+	assert.True(t, defaults.shouldRetry(ResultDoc{StatusCode: 502}, expect))
+	assert.False(t, defaults.shouldRetry(ResultDoc{StatusCode: 200}, expect))
+	assert.False(t, defaults.shouldRetry(ResultDoc{}, command))
+	assert.False(t, defaults.shouldRetry(ResultDoc{}, nil))
+	assert.True(t, defaults.shouldRetry(ResultDoc{StatusCode: 503}, nil))
+
+	onlyTimeout := RetryPolicy{Retries: 1, On: []string{RetryOnTimeout}}
+	assert.True(t, onlyTimeout.shouldRetry(ResultDoc{}, timeout))
+	assert.False(t, onlyTimeout.shouldRetry(ResultDoc{}, refused))
+}
+
+// TestRetryDelay tests exponential backoff with jitter and its cap
+func TestRetryDelay(t *testing.T) {
+	policy := RetryPolicy{Delay: 100 * time.Millisecond}
+	for retry, max := range map[int]time.Duration{1: 100 * time.Millisecond, 2: 200 * time.Millisecond, 3: 400 * time.Millisecond, 20: MaxRetryDelay} {
+		for i := 0; i < 20; i++ {
+			d := policy.delay(retry)
+			assert.GreaterOrEqual(t, d, max/2)
+			assert.LessOrEqual(t, d, max)
+		}
+	}
+	assert.LessOrEqual(t, RetryPolicy{}.delay(1), DefaultRetryDelay)
+}
+
+// TestParseRetryPolicy tests per-input retry settings over the global policy
+func TestParseRetryPolicy(t *testing.T) {
+	app := NewApp(&Config{})
+	app.logger = logging.MustGetLogger("mcall")
+	app.retry = RetryPolicy{Retries: 1, Delay: 2 * time.Second}
+
+	assert.Nil(t, app.parseInputOptions(map[string]interface{}{"input": "pwd"}).Retry)
+
+	retry := app.parseInputOptions(map[string]interface{}{"retries": float64(3), "retryOn": []interface{}{"timeout", "5XX"}}).Retry
+	assert.Equal(t, &RetryPolicy{Retries: 3, Delay: 2 * time.Second, On: []string{RetryOnTimeout, RetryOn5xx}}, retry)
+
+	retry = app.parseInputOptions(map[string]interface{}{"retryDelay": "250ms", "retryOn": "expect, connect"}).Retry
+	assert.Equal(t, &RetryPolicy{Retries: 1, Delay: 250 * time.Millisecond, On: []string{RetryOnExpect, RetryOnConnect}}, retry)
+
+	_, err := parseRetryOn("timeout,sometimes")
+	assert.Error(t, err)
+}
+
+// TestUntilPolling tests polling an input until it passes or the deadline expires
+func TestUntilPolling(t *testing.T) {
+	ready := t.TempDir() + "/ready"
+	time.AfterFunc(200*time.Millisecond, func() {
+		os.WriteFile(ready, []byte("UP"), 0644)
+	})
+
+	cf := NewCallFetch(NewPipeline(), "cat "+ready, RequestTypeCmd, "ready", "UP")
+	cf.until = 5 * time.Second
+	cf.interval = 50 * time.Millisecond
+	cf.Execute()
+	result := <-cf.result
+	assert.Equal(t, ErrorCodeSuccess, result.Error, result.ErrorMessage)
+	assert.Greater(t, result.Attempts, 1)
+
+	cf = NewCallFetch(NewPipeline(), "echo DOWN", RequestTypeCmd, "down", "UP")
+	cf.until = 200 * time.Millisecond
+	cf.interval = 50 * time.Millisecond
+	start := time.Now()
+	cf.Execute()
+	result = <-cf.result
+	assert.Equal(t, ErrorCodeExpect, result.Error, "the last failure's code is kept")
+	assert.Contains(t, result.ErrorMessage, "gave up waiting after 200ms")
+	assert.Less(t, time.Since(start), time.Second)
+
+	app := NewApp(&Config{})
+	app.logger = logging.MustGetLogger("mcall")
+	opts := app.parseInputOptions(map[string]interface{}{"until": "90s", "interval": float64(5)})
+	assert.Equal(t, 90*time.Second, opts.Until)
+	assert.Equal(t, 5*time.Second, opts.Interval)
+	assert.Equal(t, DefaultWaitDeadline, app.parseInputOptions(map[string]interface{}{"until": true}).Until)
+}
+
+// TestWaitFor tests that wait mode reports the inputs still failing at the deadline
+func TestWaitFor(t *testing.T) {
+	app := NewApp(&Config{})
+	app.logger = logging.MustGetLogger("mcall")
+
+	err := app.waitFor([]Check{{Input: "echo ok", Type: RequestTypeCmd, Name: "ok", Expect: "ok"}}, time.Second, 10*time.Millisecond)
+	assert.NoError(t, err)
+
+	checks := []Check{
+		{Input: "echo ok", Type: RequestTypeCmd, Name: "ok"},
+		{Input: "false", Type: RequestTypeCmd, Name: "broken"},
+	}
+	err = app.waitFor(checks, 100*time.Millisecond, 20*time.Millisecond)
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "1 of 2 checks failed")
+	assert.Contains(t, err.Error(), "broken:")
+
+	// An input that never passes fails the wait whatever the exit policy
+	for _, policy := range []ExitPolicy{{FailOn: FailOnAll}, {FailOn: FailOnThreshold, Threshold: 2}} {
+		app.exitPolicy = policy
+		err = app.waitFor(checks, 100*time.Millisecond, 20*time.Millisecond)
+		assert.Error(t, err, policy.String())
+		assert.Contains(t, err.Error(), "broken:")
+	}
+
+	assert.Error(t, app.waitFor(nil, time.Second, time.Second))
+}
+
+// TestExitPolicy tests the any, all and threshold fail-on modes
+func TestExitPolicy(t *testing.T) {
+	tests := []struct {
+		failOn    string
+		threshold string
+		failed    int
+		total     int
+		fails     bool
+	}{
+		{failOn: "", failed: 0, total: 5, fails: false},
+		{failOn: "", failed: 1, total: 5, fails: true},
+		{failOn: "any", failed: 1, total: 5, fails: true},
+		{failOn: "all", failed: 4, total: 5, fails: false},
+		{failOn: "ALL", failed: 5, total: 5, fails: true},
+		{failOn: "all", failed: 0, total: 0, fails: false},
+		{failOn: "threshold", threshold: "2", failed: 1, total: 5, fails: false},
+		{failOn: "threshold", threshold: "2", failed: 2, total: 5, fails: true},
+		{failOn: "threshold", threshold: "50%", failed: 2, total: 5, fails: false},
+		{failOn: "threshold", threshold: "50%", failed: 3, total: 5, fails: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(fmt.Sprintf("%s/%s/%d-of-%d", tt.failOn, tt.threshold, tt.failed, tt.total), func(t *testing.T) {
+			policy, err := parseExitPolicy(tt.failOn, tt.threshold)
+			assert.NoError(t, err)
+			assert.Equal(t, tt.fails, policy.Fails(tt.failed, tt.total))
+		})
+	}
+
+	for _, invalid := range [][2]string{{"some", ""}, {"threshold", ""}, {"threshold", "0"}, {"threshold", "150%"}, {"threshold", "x"}} {
+		_, err := parseExitPolicy(invalid[0], invalid[1])
+		assert.Error(t, err, "%v should be rejected", invalid)
+	}
+}
+
+// TestRunAndReport tests the summary line and the check failure returned for exit status
+func TestRunAndReport(t *testing.T) {
+	app := NewApp(&Config{})
+	app.logger = logging.MustGetLogger("mcall")
+	checks := []Check{
+		{Input: "echo ok", Type: RequestTypeCmd, Name: "ok"},
+		{Input: "false", Type: RequestTypeCmd, Name: "broken"},
+	}
+
+	var summary strings.Builder
+	err := app.runAndReport(checks, app.exitPolicy, &summary)
+	var failure *CheckFailure
+	assert.True(t, errors.As(err, &failure))
+	assert.Len(t, failure.Failed, 1)
+	assert.Equal(t, "mcall: 1 of 2 checks failed (fail-on any): broken\n", summary.String())
+
+	summary.Reset()
+	app.exitPolicy = ExitPolicy{FailOn: FailOnAll}
+	assert.NoError(t, app.runAndReport(checks, app.exitPolicy, &summary))
+	assert.Contains(t, summary.String(), "1 of 2 checks failed (fail-on all)")
+
+	summary.Reset()
+	assert.NoError(t, app.runAndReport(checks[:1], app.exitPolicy, &summary))
+	assert.Equal(t, "mcall: 1 of 1 checks passed\n", summary.String())
+}
+
+// TestInputItem tests the input::expect syntax
+func TestInputItem(t *testing.T) {
+	tests := []struct {
+		spec   string
+		input  string
+		expect interface{}
+	}{
+		{spec: "echo hello", input: "echo hello"},
+		{spec: "echo hello::hello", input: "echo hello", expect: "hello"},
+		{spec: "http://localhost:3000/health :: status == 200", input: "http://localhost:3000/health", expect: "status == 200"},
+		{spec: "http://[::1]:8080/", input: "http://[::1]:8080/"},
+		{spec: "http://[::1]:8080/::OK", input: "http://[::1]:8080/", expect: "OK"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.spec, func(t *testing.T) {
+			item := inputItem(tt.spec)
+			assert.Equal(t, tt.input, item["input"])
+			assert.Equal(t, tt.expect, item["expect"])
+		})
+	}
+}
+
+// TestParseCLIInputs tests repeated flags, positional matching and default types
+func TestParseCLIInputs(t *testing.T) {
+	app := NewApp(&Config{})
+	app.logger = logging.MustGetLogger("mcall")
+
+	checks, err := app.parseCLIInputs(CLIInputs{
+		List:    "pwd, http://localhost:3000/health",
+		Inputs:  []string{"echo a,b::a,b", "echo x"},
+		Expects: []string{"", "", "ignored", "x"},
+		Names:   []string{"cwd"},
+		Type:    RequestTypeCmd,
+		Name:    "adhoc",
+	}, nil)
+	assert.NoError(t, err)
+	inputs, types, names, expects := splitChecks(checks)
+	assert.Equal(t, []string{"pwd", "http://localhost:3000/health", "echo a,b", "echo x"}, inputs)
+	assert.Equal(t, []string{RequestTypeCmd, RequestTypeGet, RequestTypeCmd, RequestTypeCmd}, types)
+	assert.Equal(t, []string{"cwd", "adhoc", "adhoc", "adhoc"}, names)
+	assert.Equal(t, []string{"", "", "a,b", "x"}, expects, "input::expect wins over --expect")
+
+	checks, err = app.parseCLIInputs(CLIInputs{Inputs: []string{"localhost:6379", "http://localhost/"}, Type: RequestTypeTCP}, nil)
+	assert.NoError(t, err)
+	_, types, _, _ = splitChecks(checks)
+	assert.Equal(t, []string{RequestTypeTCP, RequestTypeGet}, types)
+
+	checks, err = app.parseCLIInputs(CLIInputs{Inputs: []string{"http://localhost/", "uptime"}, Types: []string{RequestTypePost}, Type: RequestTypeGet}, nil)
+	assert.NoError(t, err)
+	_, types, _, _ = splitChecks(checks)
+	assert.Equal(t, []string{RequestTypePost, RequestTypeCmd}, types)
+
+	_, err = app.parseCLIInputs(CLIInputs{List: " , "}, nil)
+	assert.Error(t, err)
+}
+
+// TestParseCLIInputsFromReader tests reading inputs from a file and stdin
+func TestParseCLIInputsFromReader(t *testing.T) {
+	app := NewApp(&Config{})
+	app.logger = logging.MustGetLogger("mcall")
+
+	stdin := strings.NewReader(`
+# smoke checks
+echo up::up
+{"input": "http://localhost:3000/health", "type": "get", "name": "health", "expectStatus": "2xx", "timeout": 3}
+`)
+	checks, err := app.parseCLIInputs(CLIInputs{List: "-", Type: RequestTypeCmd}, stdin)
+	assert.NoError(t, err)
+	inputs, types, names, expects := splitChecks(checks)
+	assert.Equal(t, []string{"echo up", "http://localhost:3000/health"}, inputs)
+	assert.Equal(t, []string{RequestTypeCmd, RequestTypeGet}, types)
+	assert.Equal(t, []string{"", "health"}, names)
+	assert.Equal(t, []string{"up", ""}, expects)
+	assert.Equal(t, 3*time.Second, checks[1].Timeout)
+	assert.Equal(t, "2xx", checks[1].ExpectStatus.String())
+
+	path := t.TempDir() + "/checks.jsonl"
+	assert.NoError(t, os.WriteFile(path, []byte("echo one\n{\"name\": \"no-input\"}\n"), 0644))
+	_, err = app.parseCLIInputs(CLIInputs{List: "@" + path}, nil)
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "checks.jsonl:2: missing input")
+
+	_, err = app.parseCLIInputs(CLIInputs{List: "@/nonexistent/checks.jsonl"}, nil)
+	assert.Error(t, err)
+}
+
+// TestConfigInputsList tests request.inputs decoded from YAML alongside the legacy JSON string
+func TestConfigInputsList(t *testing.T) {
+	path := t.TempDir() + "/mcall.yaml"
+	assert.NoError(t, os.WriteFile(path, []byte(`request:
+  subject: smoke
+  type: get
+  input: '{"inputs": [{"input": "pwd", "type": "cmd"}]}'
+  inputs:
+    - &api
+      name: api
+      input: http://localhost:3000/health
+      query: {userId: 7, Tags: [a, b]}
+      headers: {X-Api-Key: abc}
+      body: {Nested: {Key: 1}}
+      expectStatus: [200, 3xx]
+      maxLatency: 250
+      timeout: 2
+      retries: 0
+    - <<: *api
+      name: api-v2
+      input: http://localhost:3000/v2/health
+    - input: echo hi
+      type: sh
+      expect: hi
+      until: true
+`), 0644))
+
+	config, err := loadConfig(path)
+	assert.NoError(t, err)
+	assert.Len(t, config.Request.Inputs, 3)
+
+	app := NewApp(config)
+	app.logger = logging.MustGetLogger("mcall")
+	checks := app.configInputs()
+	inputs, types, names, expects := splitChecks(checks)
+
+	assert.Equal(t, []string{"pwd", "http://localhost:3000/health", "http://localhost:3000/v2/health", "echo hi"}, inputs)
+	assert.Equal(t, []string{RequestTypeCmd, RequestTypeGet, RequestTypeGet, RequestTypeShell}, types, "request.type is the default")
+	assert.Equal(t, []string{"smoke", "api", "api-v2", "smoke"}, names, "the subject names unnamed inputs")
+	assert.Equal(t, []string{"", "", "", "hi"}, expects)
+
+	api := checks[1]
+	assert.Equal(t, 2*time.Second, api.Timeout)
+	assert.Equal(t, 250*time.Millisecond, api.MaxLatency)
+	assert.Equal(t, "200,3xx", api.ExpectStatus.String())
+	assert.Equal(t, "7", api.HTTP.Query.Get("userId"))
+	assert.Equal(t, []string{"a", "b"}, api.HTTP.Query["Tags"], "keys inside inputs keep their case")
+	assert.Equal(t, "abc", api.HTTP.Headers["X-Api-Key"])
+	assert.JSONEq(t, `{"Nested": {"Key": 1}}`, api.HTTP.Body)
+	assert.NotNil(t, api.Retry)
+	assert.Equal(t, 0, api.Retry.Retries)
+	assert.Equal(t, "200,3xx", checks[2].ExpectStatus.String(), "merge keys copy fields")
+	assert.Equal(t, DefaultWaitDeadline, checks[3].Until)
+}
+
+// TestDecodeInputConfig tests that input item maps decode like request.inputs
+func TestDecodeInputConfig(t *testing.T) {
+	cfg, err := decodeInputConfig(map[string]interface{}{
+		"input":      "http://localhost/",
+		"retries":    float64(2),
+		"expectFail": "true",
+		"headers":    map[string]interface{}{"X-Count": float64(3)},
+		"unknown":    "ignored",
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, 2, *cfg.Retries)
+	assert.True(t, cfg.ExpectFail)
+	assert.Equal(t, "3", cfg.Headers["X-Count"])
+
+	_, err = decodeInputConfig(map[string]interface{}{"input": "pwd", "headers": "X-Count: 3"})
+	assert.Error(t, err)
+}
+
+// TestChecksStayAligned tests that inputs without a type or name do not shift
+// the fields of the inputs after them
+func TestChecksStayAligned(t *testing.T) {
+	config := &Config{}
+	config.Request.Subject = "smoke"
+	app := NewApp(config)
+	app.logger = logging.MustGetLogger("mcall")
+
+	checks := app.parseInputParams(`{"inputs": [
+		{"input": "pwd"},
+		{"input": "http://localhost:3000/health", "type": "get", "name": "health", "expect": "ok"},
+		{"input": "echo hi", "name": "greeting", "timeout": 2}
+	]}`)
+	inputs, types, names, expects := splitChecks(checks)
+	assert.Equal(t, []string{"pwd", "http://localhost:3000/health", "echo hi"}, inputs)
+	assert.Equal(t, []string{RequestTypeCmd, RequestTypeGet, RequestTypeCmd}, types)
+	assert.Equal(t, []string{"smoke", "health", "greeting"}, names)
+	assert.Equal(t, []string{"", "ok", ""}, expects)
+	assert.Equal(t, 2*time.Second, checks[2].Timeout)
+
+	results := app.execCmd([]Check{checks[0], checks[2]})
+	assert.Equal(t, "smoke", results[0]["name"])
+	assert.Equal(t, "greeting", results[1]["name"])
+	assert.Equal(t, "hi\n", results[1]["result"])
+}
+
+// TestGenerateTasks tests that tasks carry each check's fields to the worker
+func TestGenerateTasks(t *testing.T) {
+	config := &Config{}
+	config.Request.Input = `{"inputs": [
+		{"input": "pwd"},
+		{"input": "http://localhost:3000/health", "type": "get", "name": "health", "expectStatus": "2xx", "retries": 2, "headers": {"X-Token": "abc"}}
+	]}`
+	app := NewApp(config)
+	app.logger = logging.MustGetLogger("mcall")
+
+	tasks := app.generateTasks()
+	assert.Len(t, tasks, 2)
+	assert.Equal(t, "pwd", tasks[0]["command"])
+	assert.Equal(t, RequestTypeCmd, tasks[0]["type"])
+	assert.Equal(t, "health", tasks[1]["name"])
+
+	// Tasks travel as JSON in a ConfigMap
+	data, err := json.Marshal(tasks[1])
+	assert.NoError(t, err)
+	var task map[string]interface{}
+	assert.NoError(t, json.Unmarshal(data, &task))
+	options := app.parseInputOptions(task)
+	assert.Equal(t, "2xx", options.ExpectStatus.String())
+	assert.Equal(t, 2, options.Retry.Retries)
+	assert.Equal(t, "abc", options.HTTP.Headers["X-Token"])
+}
+
 // BenchmarkMainExec benchmarks the main execution function
 func BenchmarkMainExec(b *testing.B) {
 	args := Args{
@@ -904,9 +1848,7 @@ func TestExpectValidation(t *testing.T) {
 
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			// Create a new FetchedInput for each test to avoid conflicts
-			testFetchedInput := NewFetchedInput()
-			cf := NewCallFetch(testFetchedInput, pipeline, tt.input, tt.sType, tt.taskName, tt.expect)
+			cf := NewCallFetch(pipeline, tt.input, tt.sType, tt.taskName, tt.expect)
 			err := cf.Execute()
 
 			if tt.shouldPass {
@@ -920,7 +1862,6 @@ func TestExpectValidation(t *testing.T) {
 
 // TestCallFetchWithExpect tests CallFetch with expect parameter
 func TestCallFetchWithExpect(t *testing.T) {
-	fetchedInput := NewFetchedInput()
 	pipeline := NewPipeline()
 
 	tests := []struct {
@@ -962,7 +1903,7 @@ func TestCallFetchWithExpect(t *testing.T) {
 
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			cf := NewCallFetch(fetchedInput, pipeline, tt.input, tt.sType, tt.taskName, tt.expect)
+			cf := NewCallFetch(pipeline, tt.input, tt.sType, tt.taskName, tt.expect)
 			assert.NotNil(t, cf)
 			assert.Equal(t, tt.input, cf.input)
 			assert.Equal(t, tt.sType, cf.sType)
@@ -1046,7 +1987,8 @@ func TestParseConfigInputWithExpect(t *testing.T) {
 
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			inputs, types, names, expects := app.parseConfigInput(tt.inputStr)
+			app.config.Request.Input = tt.inputStr
+			inputs, types, names, expects := splitChecks(app.configInputs())
 
 			assert.Equal(t, tt.expectedInputs, inputs)
 			assert.Equal(t, tt.expectedTypes, types)
@@ -1098,7 +2040,7 @@ func TestParseInputParamsWithExpect(t *testing.T) {
 
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			inputs, types, names, expects := app.parseInputParams(tt.paramStr)
+			inputs, types, names, expects := splitChecks(app.parseInputParams(tt.paramStr))
 
 			assert.Equal(t, tt.expectedInputs, inputs)
 			assert.Equal(t, tt.expectedTypes, types)
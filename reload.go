@@ -0,0 +1,293 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+	"github.com/op/go-logging"
+)
+
+// liveConfig holds the App built from the active config of a long-running
+// mode. A reload builds a new App and swaps it in, so requests and task runs
+// that already started finish with the settings they started with.
+type liveConfig struct {
+	mu       sync.RWMutex
+	app      *App
+	version  string
+	loadedAt time.Time
+	reloads  int
+	lastErr  string
+
+	reloadMu sync.Mutex // serializes reloads
+	load     func() (*Config, error)
+}
+
+// ConfigStatus describes the active config, as served on /config
+type ConfigStatus struct {
+	Version   string `json:"version"`
+	LoadedAt  string `json:"loadedAt"`
+	Reloads   int    `json:"reloads"`
+	Checks    int    `json:"checks"`
+	LastError string `json:"lastError,omitempty"` // why the last reload was rejected
+}
+
+// configVersion identifies a config by a hash of its resolved settings, so
+// it changes with the file, its includes and the environment alike
+func configVersion(config *Config) string {
+	data, err := json.Marshal(config)
+	if err != nil {
+		return "unknown"
+	}
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:6])
+}
+
+// active returns the App built from the most recently loaded config, or app
+// itself when its config is not reloadable
+func (app *App) active() *App {
+	if app.live == nil {
+		return app
+	}
+	app.live.mu.RLock()
+	defer app.live.mu.RUnlock()
+	return app.live.app
+}
+
+// watchConfig makes the config reloadable: load is called again when one of
+// the config files or the files they include changes on disk, a file matching
+// an include pattern appears, or the process receives SIGHUP, and the result
+// replaces the running config if it is valid
+func (app *App) watchConfig(paths []string, load func() (*Config, error)) {
+	app.live = &liveConfig{
+		app:      app,
+		version:  configVersion(app.config),
+		loadedAt: time.Now(),
+		load:     load,
+	}
+	app.logger.Infof("Config version %s loaded with %d checks", app.live.version, len(app.configInputs()))
+	if len(paths) == 0 {
+		return
+	}
+
+	watch, err := newConfigWatcher(paths, app.logger)
+	if err != nil {
+		app.logger.Errorf("Cannot watch config files, reload with SIGHUP: %v", err)
+	} else {
+		go watch.run(app.live)
+	}
+
+	hup := make(chan os.Signal, 1)
+	signal.Notify(hup, syscall.SIGHUP)
+	go func() {
+		for range hup {
+			app.live.reload("SIGHUP")
+			if watch != nil {
+				watch.update()
+			}
+		}
+	}()
+}
+
+// configWatcher watches the directories of the config files and of their
+// include patterns. Watching directories rather than files notices editors
+// that replace a file on save, and files added to an included directory.
+type configWatcher struct {
+	paths   []string
+	watcher *fsnotify.Watcher
+	logger  *logging.Logger
+
+	mu       sync.Mutex
+	dirs     map[string]bool // watched directories
+	files    map[string]bool // config files read, as absolute paths
+	patterns []string        // include patterns, as absolute paths
+}
+
+// newConfigWatcher watches the config files in paths and what they include
+func newConfigWatcher(paths []string, logger *logging.Logger) (*configWatcher, error) {
+	watcher, err := fsnotify.NewWatcher()
+	if err != nil {
+		return nil, err
+	}
+	cw := &configWatcher{paths: paths, watcher: watcher, logger: logger, dirs: map[string]bool{}}
+	cw.update()
+	return cw, nil
+}
+
+// update resolves the config files and include patterns again, after a
+// reload may have changed them, and watches directories not watched yet
+func (cw *configWatcher) update() {
+	sources, _ := resolveConfigFiles(cw.paths, "")
+	files := map[string]bool{}
+	var patterns, dirs []string
+	for _, source := range sources {
+		if path, err := filepath.Abs(source.Path); err == nil {
+			files[path] = true
+			dirs = append(dirs, filepath.Dir(path))
+		}
+		for _, include := range source.Includes {
+			pattern, err := filepath.Abs(include)
+			if err != nil {
+				continue
+			}
+			patterns = append(patterns, pattern)
+			matches, _ := filepath.Glob(filepath.Dir(pattern))
+			dirs = append(dirs, matches...)
+		}
+	}
+
+	cw.mu.Lock()
+	defer cw.mu.Unlock()
+	cw.files, cw.patterns = files, patterns
+	for _, dir := range dirs {
+		if cw.dirs[dir] {
+			continue
+		}
+		if err := cw.watcher.Add(dir); err != nil {
+			cw.logger.Warningf("Cannot watch %s for config changes: %v", dir, err)
+			continue
+		}
+		cw.dirs[dir] = true
+		cw.logger.Infof("Watching %s for config changes", dir)
+	}
+}
+
+// watches reports whether path is a config file or matches an include pattern
+func (cw *configWatcher) watches(path string) bool {
+	cw.mu.Lock()
+	defer cw.mu.Unlock()
+	if cw.files[path] {
+		return true
+	}
+	for _, pattern := range cw.patterns {
+		if ok, _ := filepath.Match(pattern, path); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// run reloads the config whenever a config file or a file matching an
+// include pattern is written, created, removed or renamed, then watches what
+// the reloaded config includes
+func (cw *configWatcher) run(lc *liveConfig) {
+	for {
+		select {
+		case event, ok := <-cw.watcher.Events:
+			if !ok {
+				return
+			}
+			if event.Op&(fsnotify.Write|fsnotify.Create|fsnotify.Remove|fsnotify.Rename) == 0 || !cw.watches(event.Name) {
+				continue
+			}
+			lc.reload(fmt.Sprintf("%s changed", event.Name))
+			cw.update()
+		case err, ok := <-cw.watcher.Errors:
+			if !ok {
+				return
+			}
+			cw.logger.Warningf("Config watch error: %v", err)
+		}
+	}
+}
+
+// reload loads the config again and swaps it in. An invalid config is logged
+// and recorded in the status while the running config is kept.
+func (lc *liveConfig) reload(reason string) error {
+	lc.reloadMu.Lock()
+	defer lc.reloadMu.Unlock()
+
+	current := lc.current()
+	config, err := lc.load()
+	var next *App
+	if err == nil {
+		next, err = current.reconfigure(config)
+	}
+	if err != nil {
+		current.logger.Errorf("Rejected config reload after %s, keeping version %s: %v", reason, lc.status().Version, err)
+		lc.mu.Lock()
+		lc.lastErr = err.Error()
+		lc.mu.Unlock()
+		return err
+	}
+
+	version := configVersion(config)
+	lc.mu.Lock()
+	defer lc.mu.Unlock()
+	lc.lastErr = ""
+	if version == lc.version {
+		current.logger.Debugf("Config unchanged after %s, still version %s", reason, version)
+		return nil
+	}
+
+	if config.WebServer.Host != current.config.WebServer.Host || config.WebServer.Port != current.config.WebServer.Port {
+		current.logger.Warning("webserver.host and webserver.port take effect after a restart")
+	}
+	current.logger.Infof("Reloaded config after %s: version %s -> %s with %d checks", reason, lc.version, version, len(next.configInputs()))
+	lc.app = next
+	lc.version = version
+	lc.loadedAt = time.Now()
+	lc.reloads++
+	return nil
+}
+
+// current returns the active App
+func (lc *liveConfig) current() *App {
+	lc.mu.RLock()
+	defer lc.mu.RUnlock()
+	return lc.app
+}
+
+// status describes the active config
+func (lc *liveConfig) status() ConfigStatus {
+	lc.mu.RLock()
+	defer lc.mu.RUnlock()
+	return ConfigStatus{
+		Version:   lc.version,
+		LoadedAt:  lc.loadedAt.UTC().Format(time.RFC3339),
+		Reloads:   lc.reloads,
+		Checks:    len(lc.app.configInputs()),
+		LastError: lc.lastErr,
+	}
+}
+
+// reconfigure builds an App running config that keeps app's logger,
+// Kubernetes client, namespace, selection and template variables, which are
+// not reloaded
+func (app *App) reconfigure(config *Config) (*App, error) {
+	next := NewApp(config)
+	next.logger = app.logger
+	next.clientset = app.clientset
+	next.leaderElection = app.leaderElection
+	next.namespace = app.namespace
+	next.lockName = app.lockName
+	next.selector = app.selector
+	next.vars = app.vars
+	next.live = app.live
+
+	var err error
+	if next.exitPolicy, err = parseExitPolicy(config.Exit.FailOn, config.Exit.Threshold); err != nil {
+		return nil, fmt.Errorf("invalid exit policy: %w", err)
+	}
+	return next, nil
+}
+
+// configHandle reports the active config version
+func (app *App) configHandle(w http.ResponseWriter, r *http.Request) {
+	status := ConfigStatus{Version: configVersion(app.config), Checks: len(app.configInputs())}
+	if app.live != nil {
+		status = app.live.status()
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(status)
+}
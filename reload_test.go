@@ -0,0 +1,132 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/op/go-logging"
+	"github.com/stretchr/testify/assert"
+)
+
+// writeChecksConfig writes a config file running the given commands
+func writeChecksConfig(t *testing.T, path string, inputs ...string) {
+	data := "request:\n    timeout: 5\n    inputs:\n"
+	for _, input := range inputs {
+		data += "        - input: " + input + "\n"
+	}
+	assert.NoError(t, os.WriteFile(path, []byte(data), 0644))
+}
+
+// newReloadableApp loads path and makes its config reloadable without
+// watching the file
+func newReloadableApp(t *testing.T, path string) *App {
+	load := func() (*Config, error) { return loadSettings([]string{path}, Args{}) }
+	config, err := load()
+	assert.NoError(t, err)
+
+	app := NewApp(config)
+	app.logger = logging.MustGetLogger("mcall")
+	app.watchConfig(nil, load)
+	return app
+}
+
+// TestConfigReload tests that a valid config is swapped in and an invalid one
+// is rejected while the running config is kept
+func TestConfigReload(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "mcall.yaml")
+	writeChecksConfig(t, path, "pwd")
+	app := newReloadableApp(t, path)
+	first := app.live.status()
+	assert.Equal(t, 1, first.Checks)
+
+	// Unchanged content keeps the version
+	assert.NoError(t, app.live.reload("test"))
+	assert.Equal(t, first.Version, app.live.status().Version)
+	assert.Equal(t, 0, app.live.status().Reloads)
+
+	writeChecksConfig(t, path, "pwd", "ls")
+	assert.NoError(t, app.live.reload("test"))
+	status := app.live.status()
+	assert.NotEqual(t, first.Version, status.Version)
+	assert.Equal(t, 1, status.Reloads)
+	assert.Len(t, app.active().configInputs(), 2)
+	assert.Same(t, app.live, app.active().live, "reloaded apps stay reloadable")
+
+	// An invalid config is rejected and reported without dropping the running one
+	assert.NoError(t, os.WriteFile(path, []byte("request:\n    timeout: soon\n"), 0644))
+	assert.Error(t, app.live.reload("test"))
+	rejected := app.live.status()
+	assert.Equal(t, status.Version, rejected.Version)
+	assert.Contains(t, rejected.LastError, "request.timeout: must be a whole number")
+	assert.Len(t, app.active().configInputs(), 2)
+
+	// The next valid reload clears the error
+	writeChecksConfig(t, path, "ls")
+	assert.NoError(t, app.live.reload("test"))
+	assert.Empty(t, app.live.status().LastError)
+	assert.Len(t, app.active().configInputs(), 1)
+}
+
+// TestConfigReloadOnChange tests that writing the config file reloads it
+func TestConfigReloadOnChange(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "mcall.yaml")
+	writeChecksConfig(t, path, "pwd")
+	load := func() (*Config, error) { return loadSettings([]string{path}, Args{}) }
+	config, err := load()
+	assert.NoError(t, err)
+	app := NewApp(config)
+	app.logger = logging.MustGetLogger("mcall")
+	app.watchConfig([]string{path}, load)
+
+	writeChecksConfig(t, path, "pwd", "ls", "date")
+	assert.Eventually(t, func() bool {
+		return len(app.active().configInputs()) == 3
+	}, 5*time.Second, 50*time.Millisecond)
+}
+
+// TestConfigReloadOnInclude tests that a file added to an included directory
+// reloads the config, and that files it includes are watched in turn
+func TestConfigReloadOnInclude(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "mcall.yaml")
+	assert.NoError(t, os.WriteFile(path, []byte("include: checks.d/*.yaml\nrequest:\n    inputs:\n        - input: pwd\n"), 0644))
+	assert.NoError(t, os.Mkdir(filepath.Join(dir, "checks.d"), 0755))
+	assert.NoError(t, os.Mkdir(filepath.Join(dir, "extra"), 0755))
+	load := func() (*Config, error) { return loadSettings([]string{path}, Args{}) }
+	config, err := load()
+	assert.NoError(t, err)
+	app := NewApp(config)
+	app.logger = logging.MustGetLogger("mcall")
+	app.watchConfig([]string{path}, load)
+
+	assert.NoError(t, os.WriteFile(filepath.Join(dir, "checks.d", "search.yaml"), []byte("include: ../extra/*.yaml\nrequest:\n    inputs:\n        - input: ls\n"), 0644))
+	assert.Eventually(t, func() bool {
+		return len(app.active().configInputs()) == 2
+	}, 5*time.Second, 50*time.Millisecond)
+
+	writeChecksConfig(t, filepath.Join(dir, "extra", "payments.yaml"), "date")
+	assert.Eventually(t, func() bool {
+		return len(app.active().configInputs()) == 3
+	}, 5*time.Second, 50*time.Millisecond)
+}
+
+// TestConfigHandle tests that /config reports the active version
+func TestConfigHandle(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "mcall.yaml")
+	writeChecksConfig(t, path, "pwd")
+	app := newReloadableApp(t, path)
+
+	rec := httptest.NewRecorder()
+	app.active().configHandle(rec, httptest.NewRequest("GET", "/config", nil))
+	assert.Equal(t, "application/json", rec.Header().Get("Content-Type"))
+
+	var status ConfigStatus
+	assert.NoError(t, json.Unmarshal(rec.Body.Bytes(), &status))
+	assert.Equal(t, app.live.status().Version, status.Version)
+	assert.Len(t, status.Version, 12)
+	assert.Equal(t, 1, status.Checks)
+}
@@ -0,0 +1,158 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"regexp"
+	"strings"
+)
+
+// Selector picks the checks to run by tag and name. A tag term is a plain
+// tag like "slow", a label like "team=payments", a label key like "team", or
+// "type=tcp" for the check type.
+type Selector struct {
+	Tags        []string       // keep checks with any of these tags
+	ExcludeTags []string       // drop checks with any of these tags
+	NameRegex   *regexp.Regexp // keep checks whose name, or input without a name, matches
+}
+
+// parseSelector reads comma separated tag terms and a name regular expression
+func parseSelector(tags, excludeTags, nameRegex string) (Selector, error) {
+	selector := Selector{
+		Tags:        splitTerms(tags),
+		ExcludeTags: splitTerms(excludeTags),
+	}
+	if nameRegex != "" {
+		re, err := regexp.Compile(nameRegex)
+		if err != nil {
+			return Selector{}, fmt.Errorf("invalid name regex: %v", err)
+		}
+		selector.NameRegex = re
+	}
+	return selector, nil
+}
+
+// requestSelector reads the tags, exclude-tags and name-regex parameters of
+// a web request
+func requestSelector(r *http.Request) (Selector, error) {
+	return parseSelector(r.FormValue("tags"), r.FormValue("exclude-tags"), r.FormValue("name-regex"))
+}
+
+// splitTerms splits a comma separated list, dropping empty terms
+func splitTerms(value string) []string {
+	var terms []string
+	for _, term := range strings.Split(value, ",") {
+		if term = strings.TrimSpace(term); term != "" {
+			terms = append(terms, term)
+		}
+	}
+	return terms
+}
+
+// Empty reports whether the selector keeps every check
+func (s Selector) Empty() bool {
+	return len(s.Tags) == 0 && len(s.ExcludeTags) == 0 && s.NameRegex == nil
+}
+
+// Match reports whether a check is selected
+func (s Selector) Match(check Check) bool {
+	terms := checkTerms(check)
+	if len(s.Tags) > 0 && !anyTerm(terms, s.Tags) {
+		return false
+	}
+	if anyTerm(terms, s.ExcludeTags) {
+		return false
+	}
+	if s.NameRegex != nil {
+		name := check.Name
+		if name == "" {
+			name = check.Input
+		}
+		if !s.NameRegex.MatchString(name) {
+			return false
+		}
+	}
+	return true
+}
+
+// Select returns the selected checks and every check they depend on,
+// directly or through other checks, in their original order. Dependencies
+// are kept even when the selector would drop them, so a check never runs
+// without the checks it must wait for.
+func (s Selector) Select(checks []Check) []Check {
+	if s.Empty() {
+		return checks
+	}
+	byName := make(map[string][]int, len(checks))
+	for i, check := range checks {
+		byName[check.Name] = append(byName[check.Name], i)
+	}
+
+	keep := make([]bool, len(checks))
+	var queue []int
+	for i, check := range checks {
+		if s.Match(check) {
+			keep[i] = true
+			queue = append(queue, i)
+		}
+	}
+	for len(queue) > 0 {
+		i := queue[0]
+		queue = queue[1:]
+		for _, name := range checks[i].DependsOn {
+			for _, j := range byName[name] {
+				if !keep[j] {
+					keep[j] = true
+					queue = append(queue, j)
+				}
+			}
+		}
+	}
+
+	selected := make([]Check, 0, len(checks))
+	for i, check := range checks {
+		if keep[i] {
+			selected = append(selected, check)
+		}
+	}
+	return selected
+}
+
+// String describes the selector for logs and errors
+func (s Selector) String() string {
+	var parts []string
+	if len(s.Tags) > 0 {
+		parts = append(parts, "tags "+strings.Join(s.Tags, ","))
+	}
+	if len(s.ExcludeTags) > 0 {
+		parts = append(parts, "exclude-tags "+strings.Join(s.ExcludeTags, ","))
+	}
+	if s.NameRegex != nil {
+		parts = append(parts, "name-regex "+s.NameRegex.String())
+	}
+	return strings.Join(parts, ", ")
+}
+
+// checkTerms lists the terms a check can be selected by: its tags, its
+// labels as key and key=value, and its type as type=<type>
+func checkTerms(check Check) map[string]bool {
+	terms := map[string]bool{"type=" + check.Type: true}
+	for _, tag := range check.Tags {
+		terms[tag] = true
+	}
+	for key, value := range check.Labels {
+		terms[key] = true
+		terms[key+"="+value] = true
+	}
+	return terms
+}
+
+// anyTerm reports whether any of want is in terms
+func anyTerm(terms map[string]bool, want []string) bool {
+	for _, term := range want {
+		if terms[term] {
+			return true
+		}
+	}
+	return false
+}
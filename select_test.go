@@ -0,0 +1,126 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+
+	"github.com/op/go-logging"
+	"github.com/stretchr/testify/assert"
+)
+
+// selectionConfig is a config with tagged and labelled checks
+func selectionConfig() *Config {
+	config := &Config{}
+	config.Request.Inputs = []InputConfig{
+		{Input: "echo search", Name: "search-api", Tags: "smoke", Labels: map[string]string{"team": "search"}},
+		{Input: "echo payments", Name: "payments-api", Tags: []interface{}{"smoke", "slow"}, Labels: map[string]string{"team": "payments"}},
+		{Input: "localhost:6379", Name: "redis", Type: RequestTypeTCP},
+	}
+	return config
+}
+
+// TestSelector tests selection by tags, labels, type and name
+func TestSelector(t *testing.T) {
+	app := NewApp(selectionConfig())
+	app.logger = logging.MustGetLogger("mcall")
+	checks := app.configInputs()
+	assert.Equal(t, []string{"smoke"}, checks[0].Tags)
+	assert.Equal(t, "payments", checks[1].Labels["team"])
+
+	names := func(tags, excludeTags, nameRegex string) []string {
+		selector, err := parseSelector(tags, excludeTags, nameRegex)
+		assert.NoError(t, err)
+		var names []string
+		for _, check := range selector.Select(checks) {
+			names = append(names, check.Name)
+		}
+		return names
+	}
+
+	assert.Equal(t, []string{"search-api", "payments-api", "redis"}, names("", "", ""))
+	assert.Equal(t, []string{"payments-api"}, names("team=payments", "", ""))
+	assert.Equal(t, []string{"search-api", "payments-api"}, names("team", "", ""), "a label key matches any value")
+	assert.Equal(t, []string{"redis"}, names("type=tcp", "", ""))
+	assert.Equal(t, []string{"search-api", "redis"}, names("", "slow", ""))
+	assert.Equal(t, []string{"search-api"}, names("smoke, type=tcp", "slow", "-api$"))
+	assert.Empty(t, names("nightly", "", ""))
+
+	_, err := parseSelector("", "", "(")
+	assert.ErrorContains(t, err, "invalid name regex")
+}
+
+// TestSelectKeepsDependencies tests that selecting a check also selects the
+// checks it depends on, so it is still skipped when one of them fails
+func TestSelectKeepsDependencies(t *testing.T) {
+	app := NewApp(&Config{})
+	app.logger = logging.MustGetLogger("mcall")
+	checks := []Check{
+		{Name: "dns", Input: "exit 1", Type: RequestTypeShell, InputOptions: InputOptions{Tags: []string{"slow"}}},
+		{Name: "db", Input: "echo db", Type: RequestTypeShell},
+		{Name: "migrate", Input: "echo migrate", Type: RequestTypeShell, InputOptions: InputOptions{DependsOn: []string{"db"}}},
+		{Name: "api", Input: "echo api", Type: RequestTypeShell, InputOptions: InputOptions{Tags: []string{"api"}, DependsOn: []string{"dns", "migrate"}}},
+		{Name: "web", Input: "echo web", Type: RequestTypeShell},
+	}
+
+	selector, err := parseSelector("api", "slow", "")
+	assert.NoError(t, err)
+	selected := selector.Select(checks)
+	var names []string
+	for _, check := range selected {
+		names = append(names, check.Name)
+	}
+	assert.Equal(t, []string{"dns", "db", "migrate", "api"}, names, "dependencies are kept even when excluded")
+
+	results := app.runChecks(selected)
+	assert.True(t, results[3].Skipped)
+	assert.Equal(t, `skipped: dependency "dns" failed`, results[3].ErrorMessage)
+}
+
+// TestSelectedResultsCarryLabels tests that tags and labels reach the results
+// and the agent tasks
+func TestSelectedResultsCarryLabels(t *testing.T) {
+	app := NewApp(selectionConfig())
+	app.logger = logging.MustGetLogger("mcall")
+	app.selector, _ = parseSelector("team=payments", "", "")
+
+	results := app.execCmd(app.selector.Select(app.configInputs()))
+	assert.Len(t, results, 1)
+	assert.Equal(t, map[string]string{"team": "payments"}, results[0]["labels"])
+	assert.Equal(t, []string{"smoke", "slow"}, results[0]["tags"])
+
+	tasks := app.generateTasks()
+	assert.Len(t, tasks, 1)
+	data, err := json.Marshal(tasks[0])
+	assert.NoError(t, err)
+	var task map[string]interface{}
+	assert.NoError(t, json.Unmarshal(data, &task))
+	options := app.parseInputOptions(task)
+	assert.Equal(t, []string{"smoke", "slow"}, options.Tags)
+	assert.Equal(t, "payments", options.Labels["team"])
+}
+
+// TestHandlerSelection tests the selection query parameters of the web API
+func TestHandlerSelection(t *testing.T) {
+	app := NewApp(&Config{})
+	app.logger = logging.MustGetLogger("mcall")
+	params := `{"inputs": [{"input": "echo a", "name": "a", "tags": "smoke"}, {"input": "echo b", "name": "b"}]}`
+
+	form := url.Values{"type": {"cmd"}, "params": {params}, "tags": {"smoke"}}
+	rec := httptest.NewRecorder()
+	req := httptest.NewRequest("POST", "/mcall", nil)
+	req.Form = form
+	app.postHandle(rec, req)
+	assert.Equal(t, http.StatusOK, rec.Code)
+	var results []map[string]interface{}
+	assert.NoError(t, json.Unmarshal(rec.Body.Bytes(), &results))
+	assert.Len(t, results, 1)
+	assert.Equal(t, "a", results[0]["name"])
+
+	rec = httptest.NewRecorder()
+	req = httptest.NewRequest("GET", "/mcall/cmd/x?name-regex=(", nil)
+	app.getHandle(rec, req)
+	assert.Equal(t, http.StatusBadRequest, rec.Code)
+}
@@ -0,0 +1,730 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Diagnostic is one problem found in a configuration, anchored to the file
+// and line it comes from when those are known
+type Diagnostic struct {
+	File    string
+	Line    int
+	Message string
+}
+
+func (d Diagnostic) String() string {
+	switch {
+	case d.File != "" && d.Line > 0:
+		return fmt.Sprintf("%s:%d: %s", d.File, d.Line, d.Message)
+	case d.File != "":
+		return fmt.Sprintf("%s: %s", d.File, d.Message)
+	default:
+		return d.Message
+	}
+}
+
+// ValidationError reports every problem found in a configuration
+type ValidationError struct {
+	Diagnostics []Diagnostic
+}
+
+func (e *ValidationError) Error() string {
+	lines := make([]string, len(e.Diagnostics))
+	for i, d := range e.Diagnostics {
+		lines[i] = d.String()
+	}
+	return fmt.Sprintf("invalid configuration:\n  %s", strings.Join(lines, "\n  "))
+}
+
+// schemaKind is the kind of value a config key accepts
+type schemaKind int
+
+const (
+	schemaScalar schemaKind = iota // string or number, converted by viper
+	schemaInt
+	schemaBool
+	schemaList // list of scalars or a comma separated string
+	schemaMap
+	schemaInputs   // list of input items, checked by checkInputItem
+	schemaProfiles // map of profile names to config overlays
+)
+
+// schemaField describes a config key and, for maps, the keys it may contain
+type schemaField struct {
+	Kind   schemaKind
+	Fields map[string]schemaField
+}
+
+// configSchema lists the keys mcall reads from a config file
+var configSchema = schemaField{Kind: schemaMap, Fields: map[string]schemaField{
+	"include":  {Kind: schemaList},
+	"profiles": {Kind: schemaProfiles},
+	"request": {Kind: schemaMap, Fields: map[string]schemaField{
+		"subject":    {Kind: schemaScalar},
+		"timeout":    {Kind: schemaInt},
+		"input":      {Kind: schemaScalar},
+		"inputs":     {Kind: schemaInputs},
+		"type":       {Kind: schemaScalar},
+		"name":       {Kind: schemaScalar},
+		"shell":      {Kind: schemaScalar},
+		"retries":    {Kind: schemaInt},
+		"retryDelay": {Kind: schemaScalar},
+		"retryOn":    {Kind: schemaList},
+	}},
+	"response": {Kind: schemaMap, Fields: map[string]schemaField{
+		"format": {Kind: schemaScalar},
+		"order":  {Kind: schemaScalar},
+		"encoding": {Kind: schemaMap, Fields: map[string]schemaField{
+			"type": {Kind: schemaScalar},
+		}},
+		"es": {Kind: schemaMap, Fields: map[string]schemaField{
+			"host":       {Kind: schemaScalar},
+			"id":         {Kind: schemaScalar},
+			"password":   {Kind: schemaScalar},
+			"index_name": {Kind: schemaScalar},
+		}},
+	}},
+	"worker": {Kind: schemaMap, Fields: map[string]schemaField{
+		"number": {Kind: schemaInt},
+	}},
+	"log": {Kind: schemaMap, Fields: map[string]schemaField{
+		"level": {Kind: schemaScalar},
+		"file":  {Kind: schemaScalar},
+	}},
+	"webserver": {Kind: schemaMap, Fields: map[string]schemaField{
+		"enable": {Kind: schemaBool},
+		"host":   {Kind: schemaScalar},
+		"port":   {Kind: schemaScalar},
+	}},
+	"exit": {Kind: schemaMap, Fields: map[string]schemaField{
+		"failOn":    {Kind: schemaScalar},
+		"threshold": {Kind: schemaScalar},
+	}},
+}}
+
+// profileSchema lists the keys a profile may overlay: any config key but
+// include and profiles
+var profileSchema = func() schemaField {
+	profile := schemaField{Kind: schemaMap, Fields: map[string]schemaField{}}
+	for name, field := range configSchema.Fields {
+		if name != "include" && name != "profiles" {
+			profile.Fields[name] = field
+		}
+	}
+	return profile
+}()
+
+// inputItemFields lists the fields an input item may set
+var inputItemFields = map[string]bool{
+	"input": true, "type": true, "name": true, "expect": true, "timeout": true, "shell": true,
+	"method": true, "headers": true, "body": true, "query": true, "contentType": true,
+	"send": true, "read": true, "blocked": true,
+	"expectFail": true, "negate": true, "expectStatus": true, "maxLatency": true,
+	"retries": true, "retryDelay": true, "retryOn": true, "until": true, "interval": true,
+	"tags": true, "labels": true, "matrix": true, "dependsOn": true,
+}
+
+// validateConfigFile checks a config file and the files it includes
+func validateConfigFile(path string) []Diagnostic {
+	return validateConfigFiles([]string{path}, "", nil)
+}
+
+// validateConfigFiles checks config files and the files they include against
+// configSchema, after interpolating their values, and checks every input in
+// request.input and request.inputs after expanding their templates with vars,
+// returning the problems found. Of the profiles, only the named one is
+// checked. Each file is checked on its own so problems keep their file and
+// line.
+func validateConfigFiles(paths []string, profile string, vars map[string]string) []Diagnostic {
+	sources, diagnostics := resolveConfigFiles(paths, profile)
+	found := false
+	for _, source := range sources {
+		diagnostics = append(diagnostics, validateConfig(source.Path, source.Data, profile, vars)...)
+		if configNode(source.Root, "profiles", profile) != nil {
+			found = true
+		}
+	}
+	if profile != "" && !found {
+		diagnostics = append(diagnostics, Diagnostic{Message: fmt.Sprintf("unknown profile %q", profile)})
+	}
+	return diagnostics
+}
+
+// validateConfig checks config file content and the named profile; file only
+// labels the diagnostics and vars are the template variables inputs are
+// rendered with
+func validateConfig(file string, data []byte, profile string, vars map[string]string) []Diagnostic {
+	var diagnostics []Diagnostic
+	report := func(line int, format string, args ...interface{}) {
+		diagnostics = append(diagnostics, Diagnostic{File: file, Line: line, Message: fmt.Sprintf(format, args...)})
+	}
+
+	var doc yaml.Node
+	if err := yaml.Unmarshal(data, &doc); err != nil {
+		line, message := yamlErrorLine(err)
+		report(line, "%s", message)
+		return diagnostics
+	}
+	if len(doc.Content) == 0 {
+		return nil
+	}
+	// Check the values mcall will run with, not the ${...} references
+	root := selectProfile(doc.Content[0], profile)
+	expandConfigNode(root, "", expandEnv, report)
+	checkSchema(root, configSchema, "", report)
+
+	requestType := ""
+	if node := configNode(root, "request", "type"); node != nil {
+		requestType = node.Value
+		if !validRequestType(requestType) {
+			report(node.Line, "request.type: unknown type %q", requestType)
+		}
+	}
+	if node := configNode(root, "request", "timeout"); node != nil {
+		if timeout, _ := strconv.Atoi(node.Value); timeout < 0 {
+			report(node.Line, "request.timeout: must not be negative")
+		}
+	}
+	if node := configNode(root, "request", "retries"); node != nil {
+		if retries, _ := strconv.Atoi(node.Value); retries < 0 {
+			report(node.Line, "request.retries: must not be negative")
+		}
+	}
+	if node := configNode(root, "request", "retryDelay"); node != nil {
+		if _, err := parseTimeout(node.Value); err != nil {
+			report(node.Line, "request.retryDelay: %v", err)
+		}
+	}
+	if node := configNode(root, "request", "retryOn"); node != nil {
+		if _, err := parseRetryOn(scalarList(node)); err != nil {
+			report(node.Line, "request.retryOn: %v", err)
+		}
+	}
+	if node := configNode(root, "worker", "number"); node != nil {
+		if number, _ := strconv.Atoi(node.Value); number < 0 {
+			report(node.Line, "worker.number: must not be negative")
+		}
+	}
+	if node := configNode(root, "response", "order"); node != nil {
+		if node.Value != ResultOrderInput && node.Value != ResultOrderCompletion {
+			report(node.Line, "response.order: must be %s or %s", ResultOrderInput, ResultOrderCompletion)
+		}
+	}
+	if failOn := configNode(root, "exit", "failOn"); failOn != nil {
+		threshold := ""
+		if node := configNode(root, "exit", "threshold"); node != nil {
+			threshold = node.Value
+		}
+		if _, err := parseExitPolicy(failOn.Value, threshold); err != nil {
+			report(failOn.Line, "exit: %v", err)
+		}
+	}
+
+	if node := configNode(root, "request", "input"); node != nil && strings.TrimSpace(node.Value) != "" {
+		// Block scalars (input: |) start on the line after the key
+		base := node.Line
+		if node.Style&(yaml.LiteralStyle|yaml.FoldedStyle) != 0 {
+			base++
+		}
+		lineAt := func(offset int64) int {
+			if offset > int64(len(node.Value)) {
+				offset = int64(len(node.Value))
+			}
+			return base + strings.Count(node.Value[:offset], "\n")
+		}
+
+		items, offsets, err := decodeInputItems([]byte(node.Value))
+		if err != nil {
+			var offsetErr *jsonOffsetError
+			if errors.As(err, &offsetErr) {
+				report(lineAt(offsetErr.Offset), "request.input: %v", offsetErr.Err)
+			} else {
+				report(node.Line, "request.input: %v", err)
+			}
+		}
+		for i, item := range items {
+			for _, problem := range checkInputTemplates(item, requestType, vars) {
+				report(lineAt(offsets[i]), "request.input %s: %s", inputItemLabel(i, item), problem)
+			}
+		}
+	}
+
+	checkInputsNode(configNode(root, "request", "inputs"), "request.inputs", requestType, vars, report)
+	profiles := configNode(root, "profiles")
+	for _, name := range profileNames(profiles) {
+		profile := configNode(profiles, name)
+		profileType := requestType
+		if node := configNode(profile, "request", "type"); node != nil {
+			profileType = node.Value
+		}
+		checkInputsNode(configNode(profile, "request", "inputs"), "profiles."+name+".request.inputs", profileType, vars, report)
+	}
+
+	sort.SliceStable(diagnostics, func(i, j int) bool { return diagnostics[i].Line < diagnostics[j].Line })
+	return diagnostics
+}
+
+// checkInputsNode checks every input item of a request.inputs list
+func checkInputsNode(node *yaml.Node, label, requestType string, vars map[string]string, report func(int, string, ...interface{})) {
+	if node == nil || node.Kind != yaml.SequenceNode {
+		return
+	}
+	for i, element := range node.Content {
+		var item map[string]interface{}
+		if element.Kind != yaml.MappingNode || element.Decode(&item) != nil {
+			continue // reported by checkSchema
+		}
+		for _, problem := range checkInputTemplates(item, requestType, vars) {
+			report(element.Line, "%s %s: %s", label, inputItemLabel(i, item), problem)
+		}
+	}
+}
+
+// checkSchema reports keys the schema does not know and values of the wrong kind
+func checkSchema(node *yaml.Node, field schemaField, path string, report func(int, string, ...interface{})) {
+	if node.Tag == "!!null" {
+		return
+	}
+	switch field.Kind {
+	case schemaMap:
+		if node.Kind != yaml.MappingNode {
+			report(node.Line, "%s: must be a map", path)
+			return
+		}
+		for i := 0; i+1 < len(node.Content); i += 2 {
+			key, value := node.Content[i], node.Content[i+1]
+			name := key.Value
+			if path != "" {
+				name = path + "." + key.Value
+			}
+			child, ok := schemaLookup(field, key.Value)
+			if !ok {
+				report(key.Line, "%s: unknown key", name)
+				continue
+			}
+			checkSchema(value, child, name, report)
+		}
+	case schemaInt:
+		if node.Kind != yaml.ScalarNode || node.Tag != "!!int" {
+			report(node.Line, "%s: must be a whole number, got %q", path, node.Value)
+		}
+	case schemaBool:
+		if node.Kind != yaml.ScalarNode || node.Tag != "!!bool" {
+			report(node.Line, "%s: must be true or false, got %q", path, node.Value)
+		}
+	case schemaProfiles:
+		if node.Kind != yaml.MappingNode {
+			report(node.Line, "%s: must be a map of profile names", path)
+			return
+		}
+		for i := 0; i+1 < len(node.Content); i += 2 {
+			checkSchema(node.Content[i+1], profileSchema, path+"."+node.Content[i].Value, report)
+		}
+	case schemaInputs:
+		if node.Kind != yaml.SequenceNode {
+			report(node.Line, "%s: must be a list of inputs", path)
+			return
+		}
+		for _, item := range node.Content {
+			if item.Kind != yaml.MappingNode {
+				report(item.Line, "%s: each input must be a map with an input field", path)
+			}
+		}
+	case schemaList:
+		if node.Kind == yaml.ScalarNode {
+			return
+		}
+		if node.Kind != yaml.SequenceNode {
+			report(node.Line, "%s: must be a list", path)
+			return
+		}
+		for _, item := range node.Content {
+			if item.Kind != yaml.ScalarNode {
+				report(item.Line, "%s: list entries must be plain values", path)
+			}
+		}
+	default:
+		if node.Kind != yaml.ScalarNode {
+			report(node.Line, "%s: must be a single value", path)
+		}
+	}
+}
+
+// schemaLookup finds a key the way viper does, ignoring case
+func schemaLookup(field schemaField, key string) (schemaField, bool) {
+	for name, child := range field.Fields {
+		if strings.EqualFold(name, key) {
+			return child, true
+		}
+	}
+	return schemaField{}, false
+}
+
+// configNode returns the value at a key path in a YAML mapping, or nil
+func configNode(node *yaml.Node, path ...string) *yaml.Node {
+	for _, key := range path {
+		if node == nil || node.Kind != yaml.MappingNode {
+			return nil
+		}
+		var next *yaml.Node
+		for i := 0; i+1 < len(node.Content); i += 2 {
+			if strings.EqualFold(node.Content[i].Value, key) {
+				next = node.Content[i+1]
+			}
+		}
+		node = next
+	}
+	if node != nil && node.Tag == "!!null" {
+		return nil
+	}
+	return node
+}
+
+// scalarList returns a scalar's value or a sequence's values
+func scalarList(node *yaml.Node) interface{} {
+	if node.Kind != yaml.SequenceNode {
+		return node.Value
+	}
+	values := make([]string, len(node.Content))
+	for i, item := range node.Content {
+		values[i] = item.Value
+	}
+	return values
+}
+
+// yamlErrorLine splits a "yaml: line N: message" error into its line and message
+func yamlErrorLine(err error) (int, string) {
+	message := strings.TrimPrefix(err.Error(), "yaml: ")
+	if rest := strings.TrimPrefix(message, "line "); rest != message {
+		if i := strings.Index(rest, ": "); i > 0 {
+			if line, convErr := strconv.Atoi(rest[:i]); convErr == nil {
+				return line, rest[i+2:]
+			}
+		}
+	}
+	return 0, message
+}
+
+// jsonOffsetError is a JSON decoding error with the byte offset it occurred at
+type jsonOffsetError struct {
+	Offset int64
+	Err    error
+}
+
+func (e *jsonOffsetError) Error() string {
+	return e.Err.Error()
+}
+
+func (e *jsonOffsetError) Unwrap() error {
+	return e.Err
+}
+
+// decodeInputItems decodes {"inputs": [...]} like decodeConfigInput and
+// returns the byte offset each item starts at, so problems can be reported
+// on the line of the item that has them
+func decodeInputItems(data []byte) ([]map[string]interface{}, []int64, error) {
+	var items []map[string]interface{}
+	var offsets []int64
+
+	dec := json.NewDecoder(bytes.NewReader(data))
+	fail := func(err error) ([]map[string]interface{}, []int64, error) {
+		offset := dec.InputOffset()
+		var syntaxErr *json.SyntaxError
+		var typeErr *json.UnmarshalTypeError
+		switch {
+		case errors.As(err, &syntaxErr):
+			offset = syntaxErr.Offset
+		case errors.As(err, &typeErr):
+			offset = typeErr.Offset
+		}
+		return items, offsets, &jsonOffsetError{Offset: offset, Err: err}
+	}
+
+	if tok, err := dec.Token(); err != nil {
+		return fail(err)
+	} else if tok != json.Delim('{') {
+		return fail(errors.New(`must be a JSON object like {"inputs": [...]}`))
+	}
+	found := false
+	for dec.More() {
+		tok, err := dec.Token()
+		if err != nil {
+			return fail(err)
+		}
+		if key, _ := tok.(string); key != "inputs" {
+			var skip json.RawMessage
+			if err := dec.Decode(&skip); err != nil {
+				return fail(err)
+			}
+			continue
+		}
+		found = true
+		if tok, err := dec.Token(); err != nil {
+			return fail(err)
+		} else if tok != json.Delim('[') {
+			return fail(errors.New("inputs must be a list"))
+		}
+		for dec.More() {
+			// The decoder stops after the previous value; the item starts
+			// after the separating comma and whitespace
+			offset := dec.InputOffset()
+			for offset < int64(len(data)) && strings.ContainsRune(" \t\r\n,", rune(data[offset])) {
+				offset++
+			}
+			var item map[string]interface{}
+			if err := dec.Decode(&item); err != nil {
+				return fail(err)
+			}
+			items = append(items, item)
+			offsets = append(offsets, offset)
+		}
+		if _, err := dec.Token(); err != nil {
+			return fail(err)
+		}
+	}
+	if _, err := dec.Token(); err != nil {
+		return fail(err)
+	}
+	if !found {
+		return items, offsets, &jsonOffsetError{Err: errors.New("no inputs list")}
+	}
+	return items, offsets, nil
+}
+
+// inputItemLabel names an input item in diagnostics by position and name or input
+func inputItemLabel(i int, item map[string]interface{}) string {
+	if name, _ := item["name"].(string); name != "" {
+		return fmt.Sprintf("#%d (%s)", i+1, name)
+	}
+	if input, _ := item["input"].(string); input != "" {
+		return fmt.Sprintf("#%d (%s)", i+1, input)
+	}
+	return fmt.Sprintf("#%d", i+1)
+}
+
+// validRequestType reports whether CallFetch can execute a type
+func validRequestType(sType string) bool {
+	switch sType {
+	case RequestTypeCmd, RequestTypeShell, RequestTypeTCP, RequestTypeHTTP:
+		return true
+	}
+	return sType == strings.ToLower(sType) && httpMethods[strings.ToUpper(sType)]
+}
+
+// checkInputItem checks one input item, defaulting its type to requestType,
+// and returns a message for every problem found
+func checkInputItem(item map[string]interface{}, requestType string) []string {
+	var problems []string
+	report := func(format string, args ...interface{}) {
+		problems = append(problems, fmt.Sprintf(format, args...))
+	}
+
+	var unknown []string
+	for key := range item {
+		if !inputItemFields[key] {
+			unknown = append(unknown, key)
+		}
+	}
+	sort.Strings(unknown)
+	for _, key := range unknown {
+		report("unknown field %q", key)
+	}
+
+	input, _ := item["input"].(string)
+	if strings.TrimSpace(input) == "" {
+		report("missing input")
+	}
+
+	sType := requestType
+	if value, exists := item["type"]; exists {
+		str, ok := value.(string)
+		if !ok {
+			report("type must be a string")
+		}
+		sType = str
+	}
+	if sType == "" {
+		sType = RequestTypeCmd
+	}
+	if !validRequestType(sType) {
+		report("unknown type %q (want cmd, sh, tcp, http or an HTTP method like get)", sType)
+	} else if input != "" {
+		_, shell := item["shell"]
+		if err := checkTarget(input, sType, shell); err != nil {
+			report("%v", err)
+		}
+	}
+
+	for _, key := range []string{"name", "send", "contentType"} {
+		if value, exists := item[key]; exists {
+			if _, ok := value.(string); !ok {
+				report("%s must be a string", key)
+			}
+		}
+	}
+	for _, key := range []string{"read", "blocked", "expectFail", "negate"} {
+		if value, exists := item[key]; exists {
+			if _, ok := value.(bool); !ok {
+				report("%s must be true or false", key)
+			}
+		}
+	}
+	for _, key := range []string{"headers", "query"} {
+		if value, exists := item[key]; exists {
+			if _, ok := value.(map[string]interface{}); !ok {
+				report("%s must be an object", key)
+			}
+		}
+	}
+
+	if value, exists := item["expect"]; exists {
+		if expect, ok := value.(string); !ok {
+			report("expect must be a string")
+		} else if _, err := compileExpect(expect); err != nil {
+			report("%v", err)
+		}
+	}
+	if value, exists := item["shell"]; exists {
+		switch value.(type) {
+		case bool, string:
+		default:
+			report("shell must be true, false or an interpreter path")
+		}
+	}
+	if value, exists := item["method"]; exists {
+		if method, ok := value.(string); !ok || !httpMethods[strings.ToUpper(method)] {
+			report("unsupported method %v", value)
+		}
+	}
+
+	for _, key := range []string{"timeout", "retryDelay", "interval", "until"} {
+		value, exists := item[key]
+		if _, isBool := value.(bool); !exists || (key == "until" && isBool) {
+			continue
+		}
+		if d, err := parseTimeout(value); err != nil {
+			report("invalid %s: %v", key, err)
+		} else if d <= 0 {
+			report("%s must be positive", key)
+		}
+	}
+	if value, exists := item["maxLatency"]; exists {
+		if d, err := parseLatency(value); err != nil {
+			report("invalid maxLatency: %v", err)
+		} else if d <= 0 {
+			report("maxLatency must be positive")
+		}
+	}
+	if value, exists := item["expectStatus"]; exists {
+		if _, err := parseExpectStatus(value); err != nil {
+			report("invalid expectStatus: %v", err)
+		}
+	}
+	if value, exists := item["retries"]; exists {
+		switch retries := value.(type) {
+		case int:
+			if retries < 0 {
+				report("retries must be a whole number of at least 0")
+			}
+		case float64:
+			if retries < 0 || retries != float64(int(retries)) {
+				report("retries must be a whole number of at least 0")
+			}
+		default:
+			report("retries must be a whole number of at least 0")
+		}
+	}
+	if value, exists := item["retryOn"]; exists {
+		if _, err := parseRetryOn(value); err != nil {
+			report("invalid retryOn: %v", err)
+		}
+	}
+	for _, key := range []string{"tags", "dependsOn"} {
+		if value, exists := item[key]; exists {
+			if _, err := parseStringList(value); err != nil {
+				report("%s must be a list or a comma separated string", key)
+			}
+		}
+	}
+	if value, exists := item["labels"]; exists {
+		labels, ok := value.(map[string]interface{})
+		if !ok {
+			report("labels must be an object")
+		}
+		for key, label := range labels {
+			switch label.(type) {
+			case string, bool, int, float64:
+			default:
+				report("label %q must be a plain value", key)
+			}
+		}
+	}
+
+	return problems
+}
+
+// checkInputTemplates expands the matrix and templates of an input item with
+// vars and checks every resulting input. Problems of one matrix expansion
+// are prefixed with its generated name.
+func checkInputTemplates(item map[string]interface{}, requestType string, vars map[string]string) []string {
+	items, err := expandInputItem(item, vars)
+	if err != nil {
+		return []string{err.Error()}
+	}
+	var problems []string
+	for _, expanded := range items {
+		for _, problem := range checkInputItem(expanded, requestType) {
+			if name, _ := expanded["name"].(string); len(items) > 1 && name != "" {
+				problem = name + ": " + problem
+			}
+			problems = append(problems, problem)
+		}
+	}
+	return problems
+}
+
+// checkTarget checks that an input can be executed as its type: HTTP types
+// need an http(s) URL with a host, tcp a host:port address, and commands run
+// without a shell must split into arguments
+func checkTarget(input, sType string, shell bool) error {
+	switch sType {
+	case RequestTypeCmd:
+		if shell {
+			return nil
+		}
+		if _, err := splitArgs(input); err != nil {
+			return fmt.Errorf("invalid command: %v", err)
+		}
+	case RequestTypeShell:
+	case RequestTypeTCP:
+		_, port, err := net.SplitHostPort(strings.TrimPrefix(input, "tcp://"))
+		if err != nil {
+			return fmt.Errorf("invalid tcp address %q: %v", input, err)
+		}
+		if n, err := strconv.Atoi(port); err != nil || n < 1 || n > 65535 {
+			return fmt.Errorf("invalid tcp address %q: bad port %q", input, port)
+		}
+	default:
+		u, err := url.Parse(input)
+		if err != nil {
+			return fmt.Errorf("invalid URL: %v", err)
+		}
+		if u.Scheme != "http" && u.Scheme != "https" {
+			return fmt.Errorf("invalid URL %q: scheme must be http or https", input)
+		}
+		if u.Hostname() == "" {
+			return fmt.Errorf("invalid URL %q: missing host", input)
+		}
+	}
+	return nil
+}
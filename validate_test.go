@@ -0,0 +1,171 @@
+package main
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// TestValidateConfigFiles tests that the shipped configs validate cleanly
+func TestValidateConfigFiles(t *testing.T) {
+	for _, path := range []string{"etc/mcall.yaml", "etc/allow_access.yaml", "etc/block_access.yaml"} {
+		assert.Empty(t, validateConfigFile(path), path)
+	}
+
+	diagnostics := validateConfigFile("etc/missing.yaml")
+	assert.Len(t, diagnostics, 1)
+	assert.Contains(t, diagnostics[0].String(), "etc/missing.yaml: ")
+}
+
+// TestValidateConfig tests that problems are reported on the line they occur
+func TestValidateConfig(t *testing.T) {
+	config := `request:
+    timeout: "3s"
+    typ: get
+    input: |
+        {
+            "inputs":
+                [
+                    {"name": "jenkins", "type":"gte", "input":"http://jenkins/"},
+                    {"name": "redis", "type":"tcp", "input":"redis:port"},
+                    {"type":"get", "input":"jenkins.local/health", "expect": "status == "},
+                    {"input":"pwd", "timeot": 3}
+                ]
+        }
+worker:
+    number: many
+exit:
+    failOn: some
+`
+	var lines []string
+	for _, d := range validateConfig("bad.yaml", []byte(config), "", nil) {
+		lines = append(lines, d.String())
+	}
+	assert.Equal(t, []string{
+		`bad.yaml:2: request.timeout: must be a whole number, got "3s"`,
+		`bad.yaml:3: request.typ: unknown key`,
+		`bad.yaml:8: request.input #1 (jenkins): unknown type "gte" (want cmd, sh, tcp, http or an HTTP method like get)`,
+		`bad.yaml:9: request.input #2 (redis): invalid tcp address "redis:port": bad port "port"`,
+		`bad.yaml:10: request.input #3 (jenkins.local/health): invalid URL "jenkins.local/health": scheme must be http or https`,
+		`bad.yaml:10: request.input #3 (jenkins.local/health): invalid expect "status ==": expected a value but expression ended at column 10`,
+		`bad.yaml:11: request.input #4 (pwd): unknown field "timeot"`,
+		`bad.yaml:15: worker.number: must be a whole number, got "many"`,
+		`bad.yaml:17: exit: unknown fail-on mode "some" (any, all, threshold)`,
+	}, lines)
+}
+
+// TestValidateConfigSyntax tests that YAML and JSON syntax errors keep their line
+func TestValidateConfigSyntax(t *testing.T) {
+	diagnostics := validateConfig("bad.yaml", []byte("request:\n  input: [\n"), "", nil)
+	assert.Len(t, diagnostics, 1)
+	assert.Equal(t, 2, diagnostics[0].Line)
+
+	config := "request:\n    input: |\n        {\"inputs\": [\n            {\"input\": \"pwd\"},\n            {\"input\": \"ls\" \"type\": \"cmd\"}\n        ]}\n"
+	diagnostics = validateConfig("bad.yaml", []byte(config), "", nil)
+	assert.Len(t, diagnostics, 1)
+	assert.Equal(t, 5, diagnostics[0].Line)
+	assert.Contains(t, diagnostics[0].Message, "request.input: invalid character")
+
+	// A single line input is anchored on the key's own line
+	diagnostics = validateConfig("bad.yaml", []byte("request:\n  input: '{\"inputs\": [{\"input\": \"\"}]}'\n"), "", nil)
+	assert.Len(t, diagnostics, 1)
+	assert.Equal(t, "bad.yaml:2: request.input #1: missing input", diagnostics[0].String())
+}
+
+// TestValidateConfigInputsList tests that request.inputs items are checked on their own line
+func TestValidateConfigInputsList(t *testing.T) {
+	config := `request:
+  inputs:
+    - input: echo hello
+      expcet: hello
+    - just a string
+    - type: tcp
+      input: nowhere
+      retries: 2
+`
+	var lines []string
+	for _, d := range validateConfig("list.yaml", []byte(config), "", nil) {
+		lines = append(lines, d.String())
+	}
+	assert.Equal(t, []string{
+		`list.yaml:3: request.inputs #1 (echo hello): unknown field "expcet"`,
+		`list.yaml:5: request.inputs: each input must be a map with an input field`,
+		`list.yaml:6: request.inputs #3 (nowhere): invalid tcp address "nowhere": address nowhere: missing port in address`,
+	}, lines)
+
+	diagnostics := validateConfig("list.yaml", []byte("request:\n  inputs: pwd\n"), "", nil)
+	assert.Len(t, diagnostics, 1)
+	assert.Equal(t, "list.yaml:2: request.inputs: must be a list of inputs", diagnostics[0].String())
+}
+
+// TestDecodeInputItems tests item offsets and structural errors
+func TestDecodeInputItems(t *testing.T) {
+	data := "{\"inputs\": [\n  {\"input\": \"a\"},\n  {\"input\": \"b\"}\n]}"
+	items, offsets, err := decodeInputItems([]byte(data))
+	assert.NoError(t, err)
+	assert.Len(t, items, 2)
+	assert.Equal(t, "b", items[1]["input"])
+	assert.True(t, strings.HasPrefix(data[offsets[0]:], `{"input": "a"}`))
+	assert.True(t, strings.HasPrefix(data[offsets[1]:], `{"input": "b"}`))
+
+	_, _, err = decodeInputItems([]byte(`{"inputs": {"input": "a"}}`))
+	assert.EqualError(t, err, "inputs must be a list")
+	_, _, err = decodeInputItems([]byte(`{"checks": []}`))
+	assert.EqualError(t, err, "no inputs list")
+	_, _, err = decodeInputItems([]byte(`["pwd"]`))
+	assert.Error(t, err)
+}
+
+// TestCheckInputItem tests the checks applied to a single input item
+func TestCheckInputItem(t *testing.T) {
+	tests := []struct {
+		name     string
+		item     map[string]interface{}
+		problems []string
+	}{
+		{name: "command", item: map[string]interface{}{"input": "echo hi", "expect": "hi"}},
+		{name: "shell command", item: map[string]interface{}{"input": "echo 'hi", "shell": true}},
+		{name: "http", item: map[string]interface{}{"input": "https://example.com/", "type": "get", "timeout": "500ms", "expectStatus": "2xx"}},
+		{name: "method type", item: map[string]interface{}{"input": "http://example.com/", "type": "delete"}},
+		{name: "tcp", item: map[string]interface{}{"input": "tcp://localhost:6379", "type": "tcp", "until": true, "interval": 2.0}},
+		{name: "tags and labels", item: map[string]interface{}{"input": "pwd", "tags": []interface{}{"slow"}, "labels": map[string]interface{}{"team": "payments"}, "dependsOn": "dns"}},
+		{name: "bad labels", item: map[string]interface{}{"input": "pwd", "tags": 3.0, "labels": map[string]interface{}{"team": []interface{}{"a"}}},
+			problems: []string{"tags must be a list or a comma separated string", `label "team" must be a plain value`}},
+		{name: "missing input", item: map[string]interface{}{"type": "cmd"}, problems: []string{"missing input"}},
+		{name: "uppercase type", item: map[string]interface{}{"input": "pwd", "type": "CMD"},
+			problems: []string{`unknown type "CMD" (want cmd, sh, tcp, http or an HTTP method like get)`}},
+		{name: "no host", item: map[string]interface{}{"input": "http://:80", "type": "http"},
+			problems: []string{`invalid URL "http://:80": missing host`}},
+		{name: "tcp without port", item: map[string]interface{}{"input": "localhost", "type": "tcp"},
+			problems: []string{`invalid tcp address "localhost": address localhost: missing port in address`}},
+		{name: "bad options", item: map[string]interface{}{
+			"input": "pwd", "timeout": -1.0, "maxLatency": "fast", "retries": 1.5, "retryOn": "never", "method": "FETCH", "blocked": "yes",
+		}, problems: []string{
+			"blocked must be true or false",
+			"unsupported method FETCH",
+			"timeout must be positive",
+			`invalid maxLatency: time: invalid duration "fast"`,
+			"retries must be a whole number of at least 0",
+			`invalid retryOn: unknown retry condition "never"`,
+		}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.problems, checkInputItem(tt.item, ""))
+		})
+	}
+
+	// The request type applies to items without their own
+	assert.Empty(t, checkInputItem(map[string]interface{}{"input": "http://example.com/"}, RequestTypeGet))
+	assert.NotEmpty(t, checkInputItem(map[string]interface{}{"input": "http://example.com/"}, "gte"))
+}
+
+// TestUnknownTypeFails tests that a mistyped type fails instead of running as GET
+func TestUnknownTypeFails(t *testing.T) {
+	cf := NewCallFetch(NewPipeline(), "http://localhost:1/", "gte", "typo", "")
+	err := cf.Execute()
+	assert.EqualError(t, err, `unknown type "gte"`)
+	assert.Equal(t, ErrorCodeFailure, (<-cf.result).Error)
+}